@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Изменения через API администрирования выполняются последовательно
+var adminLock sync.Mutex
+
+type StopWordsRequest struct {
+	Words []string `json:"words"`
+}
+
+type DictionaryEntryRequest struct {
+	Term       string   `json:"term"`
+	Variations []string `json:"variations"`
+}
+
+type DictionaryInfo struct {
+	Name     string `json:"name"`
+	Relation string `json:"relation"`
+	Terms    int    `json:"terms"`
+}
+
+func adminMiddleware(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "Неверный токен администратора")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	bf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(bf)
+	jsonEncoder.SetEscapeHTML(false)
+	jsonEncoder.Encode(value)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bf.Bytes())
+}
+
+// Сохраняет содержимое во временный файл и заменяет им исходный, чтобы не оставить файл недописанным
+func writeFileAtomically(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func saveJsonFile(path string, value interface{}) error {
+	bf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(bf)
+	jsonEncoder.SetEscapeHTML(false)
+	jsonEncoder.SetIndent("", "  ")
+	if err := jsonEncoder.Encode(value); err != nil {
+		return err
+	}
+	return writeFileAtomically(path, bf.Bytes())
+}
+
+// Сохраняет JSON-объект так, чтобы изменение одного ключа меняло в файле только его строки:
+// порядок ключей, отступ и окончание файла берутся из существующего файла
+func saveJsonObject(path string, value interface{}) error {
+	original, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content, err := formatJsonObject(original, value)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, content)
+}
+
+func encodeJson(value interface{}) ([]byte, error) {
+	bf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(bf)
+	jsonEncoder.SetEscapeHTML(false)
+	if err := jsonEncoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(bf.Bytes(), "\n"), nil
+}
+
+// Ключи объекта верхнего уровня в порядке следования, отступ ключей и всё, что идёт после объекта
+func jsonObjectLayout(original []byte) ([]string, string, string) {
+	keys, indent, trailing := []string{}, "  ", "\n"
+	if len(bytes.TrimSpace(original)) == 0 {
+		return keys, indent, trailing
+	}
+	if end := bytes.LastIndexByte(original, '}'); end >= 0 {
+		trailing = string(original[end+1:])
+	}
+	if start := bytes.IndexByte(original, '{'); start >= 0 {
+		rest := original[start+1:]
+		if newline := bytes.IndexByte(rest, '\n'); newline >= 0 {
+			line := rest[newline+1:]
+			indent = string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(original))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return keys, indent, trailing
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		keys = append(keys, token.(string))
+	}
+	return keys, indent, trailing
+}
+
+// Ключи, которые уже есть в файле, остаются на своих местах, новые добавляются в конец по алфавиту
+func formatJsonObject(original []byte, value interface{}) ([]byte, error) {
+	encoded, err := encodeJson(value)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(encoded, &entries); err != nil {
+		return nil, err
+	}
+	keys, indent, trailing := jsonObjectLayout(original)
+	order := []string{}
+	written := make(map[string]struct{})
+	for _, key := range keys {
+		if _, ok := entries[key]; ok {
+			if _, ok := written[key]; !ok {
+				order = append(order, key)
+				written[key] = struct{}{}
+			}
+		}
+	}
+	added := []string{}
+	for key := range entries {
+		if _, ok := written[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	order = append(order, added...)
+	if len(order) == 0 {
+		return []byte("{}" + trailing), nil
+	}
+	bf := bytes.NewBufferString("{\n")
+	for i, key := range order {
+		encodedKey, _ := encodeJson(key)
+		bf.WriteString(indent)
+		bf.Write(encodedKey)
+		bf.WriteString(": ")
+		if err := json.Indent(bf, entries[key], indent, indent); err != nil {
+			return nil, err
+		}
+		if i < len(order)-1 {
+			bf.WriteString(",")
+		}
+		bf.WriteString("\n")
+	}
+	bf.WriteString("}" + trailing)
+	return bf.Bytes(), nil
+}
+
+func sortedStopWords(stopWords map[string]struct{}) []string {
+	words := make([]string, 0, len(stopWords))
+	for w := range stopWords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func stopWordsHandler(constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJson(w, sortedStopWords(getIndex().StopWords))
+			return
+		}
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+			return
+		}
+		if constants[ARG_STOP_WORDS] == "" {
+			writeError(w, http.StatusConflict, "Путь к словарю стоп-слов не задан")
+			return
+		}
+		var request StopWordsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Words) == 0 {
+			writeError(w, http.StatusBadRequest, "Ожидается объект вида {\"words\": [\"\"]}")
+			return
+		}
+		adminLock.Lock()
+		defer adminLock.Unlock()
+		index := getIndex()
+		stopWords := make(map[string]struct{}, len(index.StopWords))
+		for word := range index.StopWords {
+			stopWords[word] = struct{}{}
+		}
+		for _, word := range transformLettersFilter(request.Words) {
+			if r.Method == http.MethodPost {
+				stopWords[word] = struct{}{}
+			} else {
+				delete(stopWords, word)
+			}
+		}
+		if err := saveJsonObject(constants[ARG_STOP_WORDS], stopWords); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Не могу сохранить словарь стоп-слов: %s", err))
+			return
+		}
+		start := time.Now()
+		rebuilt, err := buildIndex(index.Documents, stopWords, constants)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Словарь стоп-слов сохранён, но поисковый индекс не перестроен: %s", err.(SearchError).What))
+			return
+		}
+		setIndex(rebuilt)
+		log.Printf("Словарь стоп-слов изменён (%d слов), поисковый индекс перестроен за %s", len(stopWords), time.Since(start).String())
+		writeJson(w, sortedStopWords(stopWords))
+	}
+}
+
+func dictionariesHandler(constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		files, err := ioutil.ReadDir(constants[ARG_DICTS_DIR])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Не могу прочитать папку словарей: %s", err))
+			return
+		}
+		result := []DictionaryInfo{}
+		for _, file := range files {
+			if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) == ".aff" {
+				continue
+			}
+			dic, err := loadDictionary(filepath.Join(constants[ARG_DICTS_DIR], file.Name()))
+			if err != nil {
+				continue
+			}
+			relation := dictionaryRelation(file.Name(), dic)
+			result = append(result, DictionaryInfo{Name: file.Name(), Relation: relation, Terms: len(dic)})
+		}
+		writeJson(w, result)
+	}
+}
+
+func dictionaryHandler(constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/admin/dictionaries/")
+		if name == "" || name != filepath.Base(name) || filepath.Ext(name) != ".json" {
+			writeError(w, http.StatusBadRequest, "Ожидается имя JSON-файла словаря из папки словарей")
+			return
+		}
+		path := filepath.Join(constants[ARG_DICTS_DIR], name)
+		adminLock.Lock()
+		defer adminLock.Unlock()
+		dic := make(Dictionary)
+		if _, err := os.Stat(path); err == nil {
+			if dic, err = loadDictionary(path); err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Sprintf("Не могу прочитать словарь '%s': %s", name, err))
+				return
+			}
+		} else if r.Method != http.MethodPost {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Словарь '%s' не найден", name))
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeJson(w, dic)
+			return
+		}
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+			return
+		}
+		var request DictionaryEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Term == "" {
+			writeError(w, http.StatusBadRequest, "Ожидается объект вида {\"term\": \"\", \"variations\": [\"\"]}")
+			return
+		}
+		if request.Term == DICTIONARY_META_RELATION || request.Term == DICTIONARY_META_ONE_WAY {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Служебный ключ '%s' нельзя изменить через API", request.Term))
+			return
+		}
+		if r.Method == http.MethodPost {
+			dic[request.Term] = appendUnique(dic[request.Term], request.Variations)
+		} else if len(request.Variations) == 0 {
+			delete(dic, request.Term)
+		} else {
+			dic[request.Term] = removeValues(dic[request.Term], request.Variations)
+			if len(dic[request.Term]) == 0 {
+				delete(dic, request.Term)
+			}
+		}
+		if err := saveJsonObject(path, dic); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Не могу сохранить словарь '%s': %s", name, err))
+			return
+		}
+		start := time.Now()
+		reloaded, err := reloadDictionaries(getIndex(), constants)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Словарь '%s' сохранён, но словари не перезагружены: %s", name, err.(SearchError).What))
+			return
+		}
+		setIndex(reloaded)
+		log.Printf("Словарь '%s' изменён, словари перезагружены за %s", name, time.Since(start).String())
+		writeJson(w, dic)
+	}
+}
+
+func appendUnique(list []string, values []string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func removeValues(list []string, values []string) []string {
+	result := []string{}
+	for _, l := range list {
+		found := false
+		for _, v := range values {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, l)
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatJsonObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		value    interface{}
+		want     string
+	}{
+		{
+			name:     "keeps key order, meta key, indent and missing trailing newline",
+			original: "{\n    \"@relation\": [\n        \"paronym\"\n    ],\n    \"язык\": [\n        \"языковой\"\n    ],\n    \"адрес\": [\n        \"адресат\"\n    ]\n}",
+			value: Dictionary{
+				"адрес":     {"адресат", "адресант"},
+				"@relation": {"paronym"},
+				"язык":      {"языковой"},
+			},
+			want: "{\n    \"@relation\": [\n        \"paronym\"\n    ],\n    \"язык\": [\n        \"языковой\"\n    ],\n    \"адрес\": [\n        \"адресат\",\n        \"адресант\"\n    ]\n}",
+		},
+		{
+			name:     "appends new keys sorted and drops removed ones",
+			original: "{\n  \"я\": {},\n  \"а\": {}\n}\n",
+			value:    map[string]struct{}{"я": {}, "в": {}, "б": {}},
+			want:     "{\n  \"я\": {},\n  \"б\": {},\n  \"в\": {}\n}\n",
+		},
+		{
+			name:     "new file",
+			original: "",
+			value:    Dictionary{"<a>": {"ссылка"}},
+			want:     "{\n  \"<a>\": [\n    \"ссылка\"\n  ]\n}\n",
+		},
+		{
+			name:     "empty object",
+			original: "{\n  \"а\": {}\n}",
+			value:    map[string]struct{}{},
+			want:     "{}",
+		},
+	}
+	for _, test := range tests {
+		got, err := formatJsonObject([]byte(test.original), test.value)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.name, got, test.want)
+		}
+	}
+}
+
+// Пропавшая папка словарей не останавливает сервис: перезагрузка возвращает ошибку
+func TestReloadDictionariesWithoutDirectory(t *testing.T) {
+	for _, mode := range []string{DICTS_EXPANSION_INDEX, DICTS_EXPANSION_QUERY} {
+		index, constants := testIndexWithDictionaries(t, cssDocuments, nil, map[string]string{ARG_DICTS_EXPANSION_MODE: mode})
+		constants[ARG_DICTS_DIR] = filepath.Join(constants[ARG_DICTS_DIR], "missing")
+		if reloaded, err := reloadDictionaries(index, constants); err == nil || reloaded != nil {
+			t.Errorf("%s mode: expected an error, got index %v", mode, reloaded)
+		}
+	}
+}
+
+// Ошибка в файле таксономии не подменяется пустой таксономией: перезагрузка возвращает ошибку
+func TestReloadDictionariesWithBrokenTaxonomy(t *testing.T) {
+	for _, mode := range []string{DICTS_EXPANSION_INDEX, DICTS_EXPANSION_QUERY} {
+		index, constants := testIndexWithDictionaries(t, cssDocuments, nil, map[string]string{ARG_DICTS_EXPANSION_MODE: mode})
+		constants[ARG_TAXONOMY_FILE] = filepath.Join(t.TempDir(), "taxonomy.json")
+		if err := ioutil.WriteFile(constants[ARG_TAXONOMY_FILE], []byte(`{"categories": [`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if reloaded, err := reloadDictionaries(index, constants); err == nil || reloaded != nil {
+			t.Errorf("%s mode: expected an error, got index %v", mode, reloaded)
+		}
+	}
+}
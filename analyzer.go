@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const FIELD_TITLE string = "title"
+const FIELD_CONTENT string = "content"
+const FIELD_KEYWORDS string = "keywords"
+
+// Разбивает текст на токены
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// Преобразует последовательность токенов: приводит к нижнему регистру, удаляет стоп-слова, выделяет основы и т.п.
+type TokenFilter interface {
+	Filter(tokens []string) []string
+}
+
+// Фильтр, результат которого зависит от языка текста (стоп-слова, основы слов)
+type LanguageTokenFilter interface {
+	FilterLanguage(tokens []string, lang string) []string
+}
+
+// Превращает текст в термины поискового индекса
+type Analyzer interface {
+	Analyze(text string) []string
+}
+
+// Анализатор, учитывающий язык документа или поисковой фразы
+type LanguageAnalyzer interface {
+	AnalyzeLanguage(text string, lang string) []string
+}
+
+// Анализатор, который умеет обработать отдельное слово, не разбивая его на части
+type TermAnalyzer interface {
+	AnalyzeTerm(term string) []string
+}
+
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string { return f(text) }
+
+type TokenFilterFunc func(tokens []string) []string
+
+func (f TokenFilterFunc) Filter(tokens []string) []string { return f(tokens) }
+
+type LanguageTokenFilterFunc func(tokens []string, lang string) []string
+
+func (f LanguageTokenFilterFunc) Filter(tokens []string) []string { return f(tokens, "") }
+
+func (f LanguageTokenFilterFunc) FilterLanguage(tokens []string, lang string) []string {
+	return f(tokens, lang)
+}
+
+type TokenizerFactory func(params map[string]string) (Tokenizer, error)
+
+type TokenFilterFactory func(params map[string]string, stopWords StopWordLists) (TokenFilter, error)
+
+var tokenizerRegistry = make(map[string]TokenizerFactory)
+var tokenFilterRegistry = make(map[string]TokenFilterFactory)
+
+func RegisterTokenizer(name string, factory TokenizerFactory) {
+	tokenizerRegistry[name] = factory
+}
+
+func RegisterTokenFilter(name string, factory TokenFilterFactory) {
+	tokenFilterRegistry[name] = factory
+}
+
+func init() {
+	RegisterTokenizer("standard", func(params map[string]string) (Tokenizer, error) {
+		return TokenizerFunc(tokenize), nil
+	})
+	RegisterTokenizer("code", func(params map[string]string) (Tokenizer, error) {
+		return TokenizerFunc(codeTokenize), nil
+	})
+	RegisterTokenFilter("lowercase", func(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+		return TokenFilterFunc(lowercaseFilter), nil
+	})
+	RegisterTokenFilter("yo", func(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+		return TokenFilterFunc(yoFilter), nil
+	})
+	RegisterTokenFilter("stop", func(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+		return LanguageTokenFilterFunc(func(tokens []string, lang string) []string {
+			return stopWordFilter(tokens, stopWords, lang)
+		}), nil
+	})
+	RegisterTokenFilter("stem", func(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+		return LanguageTokenFilterFunc(stemmerFilter), nil
+	})
+	RegisterTokenFilter("accents", func(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+		return TokenFilterFunc(accentsFilter), nil
+	})
+	RegisterTokenFilter("length", lengthFilterFactory)
+}
+
+type FilterDefinition struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Фильтр можно задать строкой с названием или объектом с параметрами
+func (definition *FilterDefinition) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		definition.Name = name
+		return nil
+	}
+	type plainDefinition FilterDefinition
+	return json.Unmarshal(data, (*plainDefinition)(definition))
+}
+
+type AnalyzerDefinition struct {
+	Tokenizer       string             `json:"tokenizer"`
+	TokenizerParams map[string]string  `json:"tokenizerParams,omitempty"`
+	Filters         []FilterDefinition `json:"filters"`
+}
+
+// Цепочка по умолчанию для полей документа: токенизация с учётом терминов из кода → нижний регистр →
+// замена «ё» → стоп-слова → основы слов
+var defaultAnalyzerDefinition = AnalyzerDefinition{
+	Tokenizer: "code",
+	Filters: []FilterDefinition{
+		{Name: "lowercase"},
+		{Name: "yo"},
+		{Name: "stop"},
+		{Name: "stem"},
+	},
+}
+
+type Pipeline struct {
+	Tokenizer Tokenizer
+	Filters   []TokenFilter
+}
+
+func (pipeline Pipeline) Analyze(text string) []string {
+	return pipeline.AnalyzeLanguage(text, "")
+}
+
+func (pipeline Pipeline) AnalyzeLanguage(text string, lang string) []string {
+	tokens := pipeline.Tokenizer.Tokenize(text)
+	for _, filter := range pipeline.Filters {
+		if languageFilter, ok := filter.(LanguageTokenFilter); ok && lang != "" {
+			tokens = languageFilter.FilterLanguage(tokens, lang)
+		} else {
+			tokens = filter.Filter(tokens)
+		}
+	}
+	return tokens
+}
+
+// Фильтры цепочки применяются к одному термину без токенизатора: так обрабатываются слова из словарей,
+// чтобы их основы совпадали с основами тех же слов в запросе
+func (pipeline Pipeline) AnalyzeTerm(term string) []string {
+	tokens := []string{term}
+	for _, filter := range pipeline.Filters {
+		tokens = filter.Filter(tokens)
+	}
+	return tokens
+}
+
+func newPipeline(definition AnalyzerDefinition, stopWords StopWordLists) (Pipeline, error) {
+	tokenizerFactory, ok := tokenizerRegistry[definition.Tokenizer]
+	if !ok {
+		return Pipeline{}, SearchError{time.Now(), fmt.Sprintf("Неизвестный токенизатор '%s'", definition.Tokenizer)}
+	}
+	tokenizer, err := tokenizerFactory(definition.TokenizerParams)
+	if err != nil {
+		return Pipeline{}, err
+	}
+	pipeline := Pipeline{Tokenizer: tokenizer}
+	for _, filterDefinition := range definition.Filters {
+		filterFactory, ok := tokenFilterRegistry[filterDefinition.Name]
+		if !ok {
+			return Pipeline{}, SearchError{time.Now(), fmt.Sprintf("Неизвестный фильтр '%s'", filterDefinition.Name)}
+		}
+		filter, err := filterFactory(filterDefinition.Params, stopWords)
+		if err != nil {
+			return Pipeline{}, err
+		}
+		pipeline.Filters = append(pipeline.Filters, filter)
+	}
+	return pipeline, nil
+}
+
+// Анализаторы для полей документа: заголовка, содержимого и ключевых слов
+type FieldAnalyzers map[string]Analyzer
+
+// Поисковый запрос анализируется всеми различающимися анализаторами полей, результаты объединяются
+type multiAnalyzer []Analyzer
+
+func (analyzers multiAnalyzer) Analyze(text string) []string {
+	return analyzers.AnalyzeLanguage(text, "")
+}
+
+func (analyzers multiAnalyzer) AnalyzeLanguage(text string, lang string) []string {
+	if len(analyzers) == 1 {
+		return analyzeLanguage(analyzers[0], text, lang)
+	}
+	result := []string{}
+	seen := make(map[string]struct{})
+	for _, analyzer := range analyzers {
+		for _, token := range analyzeLanguage(analyzer, text, lang) {
+			if _, ok := seen[token]; !ok {
+				seen[token] = struct{}{}
+				result = append(result, token)
+			}
+		}
+	}
+	return result
+}
+
+func (analyzers multiAnalyzer) AnalyzeTerm(term string) []string {
+	result := []string{}
+	for _, analyzer := range analyzers {
+		result = appendUnique(result, analyzeTerm(analyzer, term))
+	}
+	return result
+}
+
+func analyzeTerm(analyzer Analyzer, term string) []string {
+	if termAnalyzer, ok := analyzer.(TermAnalyzer); ok {
+		return termAnalyzer.AnalyzeTerm(term)
+	}
+	return analyzer.Analyze(term)
+}
+
+func analyzeLanguage(analyzer Analyzer, text string, lang string) []string {
+	if languageAnalyzer, ok := analyzer.(LanguageAnalyzer); ok && lang != "" {
+		return languageAnalyzer.AnalyzeLanguage(text, lang)
+	}
+	return analyzer.Analyze(text)
+}
+
+// Анализатор поисковой фразы с подсказкой языка из запроса
+type hintedAnalyzer struct {
+	analyzer Analyzer
+	lang     string
+}
+
+func (hinted hintedAnalyzer) Analyze(text string) []string {
+	return analyzeLanguage(hinted.analyzer, text, hinted.lang)
+}
+
+func withLanguage(analyzer Analyzer, lang string) Analyzer {
+	if lang == "" {
+		return analyzer
+	}
+	return hintedAnalyzer{analyzer, lang}
+}
+
+func loadAnalyzers(path string, stopWords StopWordLists) (FieldAnalyzers, Analyzer, error) {
+	definitions := map[string]AnalyzerDefinition{}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = json.Unmarshal(content, &definitions); err != nil {
+			return nil, nil, err
+		}
+	}
+	analyzers := make(FieldAnalyzers)
+	query := multiAnalyzer{}
+	seen := make(map[string]struct{})
+	for _, field := range []string{FIELD_TITLE, FIELD_CONTENT, FIELD_KEYWORDS} {
+		definition, ok := definitions[field]
+		if !ok {
+			definition = defaultAnalyzerDefinition
+		}
+		pipeline, err := newPipeline(definition, stopWords)
+		if err != nil {
+			if searchError, ok := err.(SearchError); ok {
+				return nil, nil, SearchError{searchError.When, fmt.Sprintf("Анализатор поля '%s': %s", field, searchError.What)}
+			}
+			return nil, nil, err
+		}
+		analyzers[field] = pipeline
+		key, _ := json.Marshal(definition)
+		if _, ok := seen[string(key)]; !ok {
+			seen[string(key)] = struct{}{}
+			query = append(query, pipeline)
+		}
+	}
+	return analyzers, query, nil
+}
+
+func lowercaseFilter(tokens []string) []string {
+	r := make([]string, len(tokens))
+	for i, token := range tokens {
+		r[i] = strings.ToLower(token)
+	}
+	return r
+}
+
+func yoFilter(tokens []string) []string {
+	r := make([]string, len(tokens))
+	for i, token := range tokens {
+		r[i] = strings.ReplaceAll(strings.ReplaceAll(token, "ё", "е"), "Ё", "Е")
+	}
+	return r
+}
+
+var accentsReplacer = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ā", "a", "ă", "a", "ą", "a",
+	"ç", "c", "ć", "c", "č", "c", "ď", "d", "đ", "d",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ē", "e", "ė", "e", "ę", "e", "ě", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ī", "i", "į", "i",
+	"ł", "l", "ñ", "n", "ń", "n", "ň", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ō", "o", "ő", "o",
+	"ř", "r", "ś", "s", "š", "s", "ş", "s", "ť", "t", "ţ", "t",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ū", "u", "ů", "u", "ű", "u", "ų", "u",
+	"ý", "y", "ÿ", "y", "ź", "z", "ż", "z", "ž", "z",
+)
+
+// Удаляет диакритические знаки, в том числе знаки ударения над русскими буквами
+func accentsFilter(tokens []string) []string {
+	r := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		token = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) {
+				return -1
+			}
+			return r
+		}, accentsReplacer.Replace(token))
+		if token != "" {
+			r = append(r, token)
+		}
+	}
+	return r
+}
+
+func lengthFilterFactory(params map[string]string, stopWords StopWordLists) (TokenFilter, error) {
+	min, max := 0, 0
+	var err error
+	if params["min"] != "" {
+		if min, err = strconv.Atoi(params["min"]); err != nil {
+			return nil, err
+		}
+	}
+	if params["max"] != "" {
+		if max, err = strconv.Atoi(params["max"]); err != nil {
+			return nil, err
+		}
+	}
+	return TokenFilterFunc(func(tokens []string) []string {
+		r := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			length := utf8.RuneCountInString(token)
+			if length >= min && (max <= 0 || length <= max) {
+				r = append(r, token)
+			}
+		}
+		return r
+	}), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testAnalyzers(t *testing.T) map[string]Analyzer {
+	_, defaultQuery, err := loadAnalyzers("", StopWordLists{Common: map[string]struct{}{"и": {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noStem, err := newPipeline(AnalyzerDefinition{
+		Tokenizer: "code",
+		Filters:   []FilterDefinition{{Name: "lowercase"}, {Name: "yo"}},
+	}, StopWordLists{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Analyzer{"default": defaultQuery, "no stemming": noStem}
+}
+
+// Основы слов из словарей должны совпадать с терминами, которые анализатор выделяет из запроса
+func TestDictionaryKeysMatchQueryTokens(t *testing.T) {
+	for name, analyzer := range testAnalyzers(t) {
+		relations := newDictionaryRelations()
+		relations.addExpansions(Dictionary{"Гриды": {"сетки"}}, nil, analyzer)
+		for _, query := range []string{"гриды", "ГРИДЫ", "сетки"} {
+			tokens := analyzer.Analyze(query)
+			if len(tokens) == 0 {
+				t.Fatalf("%s: no tokens for %q", name, query)
+			}
+			for _, token := range tokens {
+				if len(relations.Expansions[token]) == 0 {
+					t.Errorf("%s: no expansions for query token %q of %q, have %v", name, token, query, relations.Expansions)
+				}
+			}
+		}
+
+		phrases := newDictionaryRelations()
+		phrases.addPhrases(Dictionary{"адаптивный макет": {"responsive layout"}}, nil, analyzer)
+		if got := phrases.expandPhrases("Адаптивный макет", analyzer); got != "Адаптивный макет responsive+layout" {
+			t.Errorf("%s: expandPhrases = %q", name, got)
+		}
+
+		antonyms := newDictionaryRelations()
+		addRelation(antonyms.Antonyms, Dictionary{"светлый": {"тёмный"}}, analyzer)
+		want := analyzeTerm(analyzer, "темный")
+		if got := antonyms.antonymStems("светлый", analyzer); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: antonymStems = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAnalyzeTermKeepsCodeTermWhole(t *testing.T) {
+	analyzers := testAnalyzers(t)
+	if got := analyzeTerm(analyzers["no stemming"], "querySelectorAll"); !reflect.DeepEqual(got, []string{"queryselectorall"}) {
+		t.Errorf("analyzeTerm split a dictionary word: %v", got)
+	}
+	if got := analyzeTerm(analyzers["default"], "и"); len(got) != 0 {
+		t.Errorf("analyzeTerm kept a stop word: %v", got)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Множество номеров документов в виде битовой карты
+type Bitmap []uint64
+
+func newBitmap(size int) Bitmap {
+	return make(Bitmap, (size+63)/64)
+}
+
+func fullBitmap(size int) Bitmap {
+	bitmap := newBitmap(size)
+	for i := 0; i < size; i++ {
+		bitmap.set(i)
+	}
+	return bitmap
+}
+
+func (bitmap Bitmap) set(i int) {
+	bitmap[i/64] |= 1 << uint(i%64)
+}
+
+func (bitmap Bitmap) has(i int) bool {
+	return i/64 < len(bitmap) && bitmap[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (bitmap Bitmap) and(other Bitmap) Bitmap {
+	result := make(Bitmap, len(bitmap))
+	for i := range bitmap {
+		if i < len(other) {
+			result[i] = bitmap[i] & other[i]
+		}
+	}
+	return result
+}
+
+func (bitmap Bitmap) or(other Bitmap) Bitmap {
+	result := make(Bitmap, len(bitmap))
+	for i := range bitmap {
+		result[i] = bitmap[i]
+		if i < len(other) {
+			result[i] |= other[i]
+		}
+	}
+	return result
+}
+
+func (bitmap Bitmap) andNot(other Bitmap) Bitmap {
+	result := make(Bitmap, len(bitmap))
+	for i := range bitmap {
+		result[i] = bitmap[i]
+		if i < len(other) {
+			result[i] &^= other[i]
+		}
+	}
+	return result
+}
+
+// Числовое значение атрибута документа для сравнений «больше» и «меньше»
+type attributeNumber struct {
+	value    float64
+	docIndex int
+}
+
+// Инвертированные индексы атрибутов документов: значение → битовая карта документов,
+// а для чисел и дат — значения, упорядоченные по возрастанию
+type AttributeIndex struct {
+	size    int
+	values  map[string]map[string]Bitmap
+	numbers map[string][]attributeNumber
+	dates   map[string][]attributeNumber
+}
+
+func newAttributeIndex(docs []Document, taxonomy *Taxonomy) *AttributeIndex {
+	index := &AttributeIndex{
+		size:    len(docs),
+		values:  make(map[string]map[string]Bitmap),
+		numbers: make(map[string][]attributeNumber),
+		dates:   make(map[string][]attributeNumber),
+	}
+	for docIndex, doc := range docs {
+		for name, value := range documentAttributes(doc, taxonomy) {
+			index.add(name, value, docIndex)
+		}
+	}
+	for _, list := range []map[string][]attributeNumber{index.numbers, index.dates} {
+		for _, numbers := range list {
+			sort.Slice(numbers, func(i, j int) bool { return numbers[i].value < numbers[j].value })
+		}
+	}
+	return index
+}
+
+// Атрибуты документа: поля документа и значения из объекта `attributes`.
+// Категория и теги дополняются родительскими категориями и тегами из таксономии
+func documentAttributes(doc Document, taxonomy *Taxonomy) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"objectID": doc.ObjectId,
+	}
+	categories := []interface{}{}
+	for _, category := range taxonomy.categoryValues(doc.Category) {
+		categories = append(categories, category)
+	}
+	attributes["category"] = categories
+	tags := []interface{}{}
+	for _, tag := range doc.Tags {
+		for _, value := range taxonomy.tagValues(tag) {
+			tags = append(tags, value)
+		}
+	}
+	attributes["tags"] = tags
+	if doc.Lang != "" {
+		attributes["lang"] = doc.Lang
+	}
+	if doc.UpdatedAt != "" {
+		attributes["updatedAt"] = doc.UpdatedAt
+	}
+	if doc.Popularity != 0 {
+		attributes["popularity"] = doc.Popularity
+	}
+	if doc.Boost != 0 {
+		attributes["boost"] = doc.Boost
+	}
+	for name, value := range doc.Attributes {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+func (index *AttributeIndex) add(name string, value interface{}, docIndex int) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			index.add(name, item, docIndex)
+		}
+		return
+	case string:
+		if date, err := parseUpdatedAt(v); err == nil {
+			index.dates[name] = append(index.dates[name], attributeNumber{float64(date.Unix()), docIndex})
+		}
+	case float64:
+		index.numbers[name] = append(index.numbers[name], attributeNumber{v, docIndex})
+	case bool:
+	default:
+		return
+	}
+	key := attributeKey(value)
+	if _, ok := index.values[name]; !ok {
+		index.values[name] = make(map[string]Bitmap)
+	}
+	if _, ok := index.values[name][key]; !ok {
+		index.values[name][key] = newBitmap(index.size)
+	}
+	index.values[name][key].set(docIndex)
+}
+
+// Ключ значения в индексе учитывает тип, чтобы строка "1" и число 1 не совпадали
+func attributeKey(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "s:" + v
+	case float64:
+		return "n:" + strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return fmt.Sprintf("b:%t", v)
+	}
+	return ""
+}
+
+// Поля документа, которые можно использовать как атрибуты, даже если ни у одного документа они не заданы
+var documentFieldAttributes = []string{"objectID", "category", "tags", "lang", "updatedAt", "popularity", "boost"}
+
+func (index *AttributeIndex) has(name string) bool {
+	_, ok := index.values[name]
+	return ok || containsString(documentFieldAttributes, name)
+}
+
+func (index *AttributeIndex) all() Bitmap {
+	return fullBitmap(index.size)
+}
+
+// Документы, у которых атрибут равен одному из значений
+func (index *AttributeIndex) equal(name string, values []interface{}) Bitmap {
+	result := newBitmap(index.size)
+	for _, value := range values {
+		if bitmap, ok := index.values[name][attributeKey(value)]; ok {
+			result = result.or(bitmap)
+		}
+	}
+	return result
+}
+
+// Документы, у которых числовой атрибут или дата попадает в промежуток от from до to
+func (index *AttributeIndex) between(numbers []attributeNumber, from float64, includeFrom bool, to float64, includeTo bool) Bitmap {
+	result := newBitmap(index.size)
+	start := sort.Search(len(numbers), func(i int) bool {
+		return numbers[i].value > from || (includeFrom && numbers[i].value == from)
+	})
+	for _, n := range numbers[start:] {
+		if n.value > to || (!includeTo && n.value == to) {
+			break
+		}
+		result.set(n.docIndex)
+	}
+	return result
+}
+
+// Документы, подходящие под выражение фильтра и под фильтры по категориям и тегам из запроса
+func (index *AttributeIndex) allowed(filter FilterExpression, category []string, tags []string) Bitmap {
+	result := index.all()
+	if filter != nil {
+		result = filter.evaluate(index)
+	}
+	for name, values := range map[string][]string{"category": category, "tags": tags} {
+		values = removeValues(values, []string{""})
+		if len(values) == 0 {
+			continue
+		}
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		result = result.and(index.equal(name, list))
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type cacheEntry struct {
+	key  string
+	hits []Hit
+}
+
+// Кэш результатов поиска с вытеснением давно не использованных записей (LRU)
+type ResultCache struct {
+	lock       sync.Mutex
+	capacity   int
+	generation uint64
+	entries    map[string]*list.Element
+	order      *list.List
+	hits       uint64
+	misses     uint64
+}
+
+type CacheStats struct {
+	Capacity   int    `json:"capacity"`
+	Size       int    `json:"size"`
+	Generation uint64 `json:"generation"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+}
+
+func newResultCache(capacity int) *ResultCache {
+	return &ResultCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func cacheKey(searchRequest string, category []string, tags []string, options SearchOptions) string {
+	normalizedRequest := strings.TrimSpace(strings.ToLower(strings.ReplaceAll(searchRequest, "ё", "е")))
+	sortedCategory := append([]string{}, category...)
+	sort.Strings(sortedCategory)
+	sortedTags := append([]string{}, tags...)
+	sort.Strings(sortedTags)
+	return strings.Join([]string{
+		normalizedRequest,
+		strings.Join(sortedCategory, "\x1f"),
+		strings.Join(sortedTags, "\x1f"),
+		strings.Join(options.ExcludedStems, "\x1f"),
+		options.Language,
+		sortKeysString(options.Sort),
+		filterString(options.Filter),
+		options.RecencyDate,
+	}, "\x1e")
+}
+
+// Сбрасывает содержимое кэша, если индекс был перестроен (вызывается под блокировкой)
+func (cache *ResultCache) invalidateIfStale(generation uint64) {
+	if cache.generation != generation {
+		cache.entries = make(map[string]*list.Element)
+		cache.order.Init()
+		cache.generation = generation
+	}
+}
+
+func (cache *ResultCache) get(key string, generation uint64) ([]Hit, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.invalidateIfStale(generation)
+	if element, ok := cache.entries[key]; ok {
+		cache.order.MoveToFront(element)
+		cache.hits++
+		return element.Value.(*cacheEntry).hits, true
+	}
+	cache.misses++
+	return nil, false
+}
+
+func (cache *ResultCache) put(key string, generation uint64, hits []Hit) {
+	if cache.capacity <= 0 {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.invalidateIfStale(generation)
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*cacheEntry).hits = hits
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&cacheEntry{key: key, hits: hits})
+	for cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (cache *ResultCache) stats() CacheStats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return CacheStats{
+		Capacity:   cache.capacity,
+		Size:       cache.order.Len(),
+		Generation: cache.generation,
+		Hits:       cache.hits,
+		Misses:     cache.misses,
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const ENCODING_IDENTITY string = ""
+const ENCODING_GZIP string = "gzip"
+const ENCODING_BROTLI string = "br"
+
+// Сильный ETag должен различаться для разных сжатий ответа, поэтому к нему добавляется название сжатия
+func computeETag(indexId string, key string, encoding string) string {
+	hash := sha1.Sum([]byte(key))
+	if encoding == ENCODING_IDENTITY {
+		return fmt.Sprintf("\"%s-%s\"", indexId[:16], hex.EncodeToString(hash[:])[:16])
+	}
+	return fmt.Sprintf("\"%s-%s-%s\"", indexId[:16], hex.EncodeToString(hash[:])[:16], encoding)
+}
+
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		if strings.TrimSpace(strings.ToLower(params[0])) != encoding {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(param, " ", "")
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Выбирает сжатие ответа до проверки If-None-Match, чтобы и ответ 304 содержал заголовок Vary
+func negotiateEncoding(w http.ResponseWriter, r *http.Request) string {
+	w.Header().Add("Vary", "Accept-Encoding")
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	for _, encoding := range []string{ENCODING_BROTLI, ENCODING_GZIP} {
+		if acceptsEncoding(acceptEncoding, encoding) {
+			return encoding
+		}
+	}
+	return ENCODING_IDENTITY
+}
+
+func writeCompressed(w http.ResponseWriter, encoding string, body []byte) {
+	switch encoding {
+	case ENCODING_BROTLI:
+		w.Header().Set("Content-Encoding", ENCODING_BROTLI)
+		br := brotli.NewWriter(w)
+		br.Write(body)
+		br.Close()
+	case ENCODING_GZIP:
+		w.Header().Set("Content-Encoding", ENCODING_GZIP)
+		gz := gzip.NewWriter(w)
+		gz.Write(body)
+		gz.Close()
+	default:
+		w.Write(body)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ENCODING_IDENTITY},
+		{"gzip", ENCODING_GZIP},
+		{"gzip, deflate, br", ENCODING_BROTLI},
+		{"br;q=0, gzip", ENCODING_GZIP},
+		{"BR", ENCODING_BROTLI},
+		{"gzip;q=0.0", ENCODING_IDENTITY},
+		{"deflate", ENCODING_IDENTITY},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/?search=grid", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+		if got := negotiateEncoding(w, r); got != test.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", test.acceptEncoding, got, test.want)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("negotiateEncoding(%q) set Vary %q", test.acceptEncoding, vary)
+		}
+	}
+}
+
+func TestComputeETagDiffersByEncoding(t *testing.T) {
+	indexId := "0123456789abcdef0123456789abcdef"
+	seen := make(map[string]string)
+	for _, encoding := range []string{ENCODING_IDENTITY, ENCODING_GZIP, ENCODING_BROTLI} {
+		etag := computeETag(indexId, "grid", encoding)
+		if other, ok := seen[etag]; ok {
+			t.Errorf("ETag %s is the same for encodings %q and %q", etag, other, encoding)
+		}
+		seen[etag] = encoding
+		if !matchesETag("W/"+etag, etag) {
+			t.Errorf("matchesETag does not accept weak form of %s", etag)
+		}
+	}
+}
+
+// С понижением по давности ключ кэша меняется раз в сутки, без понижения — не зависит от времени
+func TestCacheKeyRecencyDate(t *testing.T) {
+	evening := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	morning := time.Date(2024, 3, 1, 0, 10, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 3, 2, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		halfLife string
+		weight   string
+		changes  bool
+	}{
+		{"365", "0.3", true},
+		{"0", "0.3", false},
+		{"365", "0", false},
+	}
+	for _, test := range tests {
+		constants := map[string]string{ARG_RANKING_RECENCY_HALF_LIFE: test.halfLife, ARG_RANKING_RECENCY_WEIGHT: test.weight}
+		key := func(now time.Time) string {
+			_, date := recencyDate(now, constants)
+			return cacheKey("grid", nil, nil, SearchOptions{RecencyDate: date})
+		}
+		if key(morning) != key(evening) {
+			t.Errorf("half-life %s, weight %s: key changes within a day", test.halfLife, test.weight)
+		}
+		if changes := key(evening) != key(nextDay); changes != test.changes {
+			t.Errorf("half-life %s, weight %s: key changes on the next day = %t, want %t", test.halfLife, test.weight, changes, test.changes)
+		}
+	}
+}
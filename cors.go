@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type CorsPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   string
+	AllowedHeaders   string
+	MaxAge           string
+	AllowCredentials bool
+}
+
+func splitList(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func loadCorsPolicy(constants map[string]string) CorsPolicy {
+	return CorsPolicy{
+		AllowedOrigins:   splitList(constants[ARG_CORS_ALLOWED_ORIGINS]),
+		AllowedMethods:   strings.Join(splitList(constants[ARG_CORS_ALLOWED_METHODS]), ", "),
+		AllowedHeaders:   strings.Join(splitList(constants[ARG_CORS_ALLOWED_HEADERS]), ", "),
+		MaxAge:           constants[ARG_CORS_MAX_AGE],
+		AllowCredentials: constants[ARG_CORS_ALLOW_CREDENTIALS] == "true",
+	}
+}
+
+// Шаблон источника задаётся как '*', 'https://doka.guide' или '*.doka.guide' (схема необязательна)
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+	host := pattern
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if !strings.EqualFold(pattern[:i], origin.Scheme) {
+			return false
+		}
+		host = pattern[i+3:]
+	}
+	host = strings.ToLower(host)
+	originHost := strings.ToLower(origin.Host)
+	if strings.HasPrefix(host, "*.") {
+		return strings.HasSuffix(originHost, host[1:])
+	}
+	return originHost == host
+}
+
+func (policy CorsPolicy) allowedOrigin(origin string) (string, bool) {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return "", false
+	}
+	for _, pattern := range policy.AllowedOrigins {
+		if matchOrigin(pattern, parsed) {
+			if pattern == "*" && !policy.AllowCredentials {
+				return "*", true
+			}
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+func corsMiddleware(policy CorsPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		allowed, ok := "", false
+		if origin != "" {
+			allowed, ok = policy.allowedOrigin(origin)
+		}
+		if ok {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if r.Method == http.MethodOptions {
+			if ok && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", policy.AllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", policy.AllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", policy.MaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if ok {
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		}
+		next(w, r)
+	}
+}
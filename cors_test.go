@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://example.com", true},
+		{"https://doka.guide", "https://doka.guide", true},
+		{"https://doka.guide", "http://doka.guide", false},
+		{"https://doka.guide", "https://DOKA.guide", true},
+		{"doka.guide", "http://doka.guide", true},
+		{"doka.guide", "https://doka.guide.evil.com", false},
+		{"*.doka.guide", "https://beta.doka.guide", true},
+		{"*.doka.guide", "https://a.b.doka.guide", true},
+		{"*.doka.guide", "https://doka.guide", false},
+		{"*.doka.guide", "https://evildoka.guide", false},
+		{"https://*.doka.guide", "http://beta.doka.guide", false},
+		{"http://localhost:8080", "http://localhost:8080", true},
+		{"http://localhost:8080", "http://localhost:3000", false},
+	}
+	for _, test := range tests {
+		origin, err := url.Parse(test.origin)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %s", test.origin, err)
+		}
+		if got := matchOrigin(test.pattern, origin); got != test.want {
+			t.Errorf("matchOrigin(%q, %q) = %t, want %t", test.pattern, test.origin, got, test.want)
+		}
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		policy CorsPolicy
+		origin string
+		want   string
+		ok     bool
+	}{
+		{CorsPolicy{AllowedOrigins: []string{"*"}}, "https://example.com", "*", true},
+		{CorsPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://example.com", "https://example.com", true},
+		{CorsPolicy{AllowedOrigins: []string{"https://doka.guide"}}, "https://doka.guide", "https://doka.guide", true},
+		{CorsPolicy{AllowedOrigins: []string{"https://doka.guide"}}, "https://example.com", "", false},
+		{CorsPolicy{AllowedOrigins: []string{"*"}}, "null", "", false},
+		{CorsPolicy{}, "https://doka.guide", "", false},
+	}
+	for _, test := range tests {
+		got, ok := test.policy.allowedOrigin(test.origin)
+		if got != test.want || ok != test.ok {
+			t.Errorf("allowedOrigin(%v, %q) = %q, %t, want %q, %t", test.policy.AllowedOrigins, test.origin, got, ok, test.want, test.ok)
+		}
+	}
+}
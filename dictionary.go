@@ -0,0 +1,269 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// Служебный ключ словаря, в котором указывается тип отношения между терминами
+const DICTIONARY_META_RELATION string = "@relation"
+
+// Служебный ключ словаря со списком терминов, которые заменяются вариантами только в одну сторону
+const DICTIONARY_META_ONE_WAY string = "@oneWay"
+
+const RELATION_TRANSLATION string = "translation"
+const RELATION_SYNONYM string = "synonym"
+const RELATION_PARONYM string = "paronym"
+const RELATION_ANTONYM string = "antonym"
+
+const DICTS_EXPANSION_INDEX string = "index"
+const DICTS_EXPANSION_QUERY string = "query"
+
+// Отношения из словарей, которые не расширяют поисковый индекс
+type DictionaryRelations struct {
+	Paronyms map[string][]string
+	Antonyms map[string][]string
+	// Фразы из нескольких слов: основы слов фразы через пробел → эквивалентные фразы
+	Phrases       map[string][]string
+	PhraseMaxSize int
+	// Основы вариантов переводов и синонимов для расширения запроса во время поиска
+	Expansions map[string][]string
+	// Основы вариантов, под которыми документы добавлены в индекс, → основы из текста документов (нужны для подсветки)
+	IndexedVariants map[string][]string
+}
+
+func newDictionaryRelations() DictionaryRelations {
+	return DictionaryRelations{
+		Paronyms:        make(map[string][]string),
+		Antonyms:        make(map[string][]string),
+		Phrases:         make(map[string][]string),
+		Expansions:      make(map[string][]string),
+		IndexedVariants: make(map[string][]string),
+	}
+}
+
+// Тип отношения берётся из служебного ключа словаря, а при его отсутствии — из префикса имени файла
+func dictionaryRelation(fileName string, dic Dictionary) string {
+	if meta, ok := dic[DICTIONARY_META_RELATION]; ok {
+		delete(dic, DICTIONARY_META_RELATION)
+		if len(meta) > 0 {
+			return meta[0]
+		}
+	}
+	prefixes := map[string]string{
+		"terms-":        RELATION_TRANSLATION,
+		"translations-": RELATION_TRANSLATION,
+		"synonyms-":     RELATION_SYNONYM,
+		"paronyms-":     RELATION_PARONYM,
+		"antonyms-":     RELATION_ANTONYM,
+	}
+	for prefix, relation := range prefixes {
+		if strings.HasPrefix(fileName, prefix) {
+			return relation
+		}
+	}
+	log.Printf("Тип отношения для словаря '%s' не указан, термины будут использованы как синонимы", fileName)
+	return RELATION_SYNONYM
+}
+
+// Термины с односторонней заменой (правила «a => b» из Solr); служебный ключ удаляется из словаря
+func dictionaryOneWayTerms(dic Dictionary) map[string]struct{} {
+	oneWay := make(map[string]struct{})
+	for _, term := range dic[DICTIONARY_META_ONE_WAY] {
+		oneWay[term] = struct{}{}
+	}
+	delete(dic, DICTIONARY_META_ONE_WAY)
+	return oneWay
+}
+
+// Замена термина вариантом односторонняя, если термин отмечен и обратной связи в словаре нет
+func isOneWay(dic Dictionary, oneWay map[string]struct{}, term string, variant string) bool {
+	if _, ok := oneWay[term]; !ok {
+		return false
+	}
+	return !containsString(dic[variant], term)
+}
+
+func isSingleWord(term string) bool {
+	return term != "" && !strings.ContainsAny(term, " ,!?-")
+}
+
+// Отношение симметрично: если «белый» — антоним «чёрного», то и «чёрный» — антоним «белого»
+func addRelation(relationMap map[string][]string, dic Dictionary, analyzer Analyzer) int {
+	counter := 0
+	for dTerm, dVars := range dic {
+		if !isSingleWord(dTerm) {
+			continue
+		}
+		term := strings.ToLower(strings.ReplaceAll(dTerm, "ё", "е"))
+		for _, dVar := range dVars {
+			if !isSingleWord(dVar) {
+				continue
+			}
+			variation := strings.ToLower(strings.ReplaceAll(dVar, "ё", "е"))
+			for _, stem := range analyzeTerm(analyzer, term) {
+				relationMap[stem] = append(relationMap[stem], variation)
+			}
+			for _, stem := range analyzeTerm(analyzer, variation) {
+				relationMap[stem] = append(relationMap[stem], term)
+			}
+		}
+		counter++
+	}
+	return counter
+}
+
+// Пары однословных терминов для расширения запроса во время поиска (в обе стороны, кроме односторонних замен)
+func (relations *DictionaryRelations) addExpansions(dic Dictionary, oneWay map[string]struct{}, analyzer Analyzer) int {
+	counter := 0
+	for dTerm, dVars := range dic {
+		if !isSingleWord(dTerm) {
+			continue
+		}
+		terms := analyzeTerm(analyzer, dTerm)
+		for _, dVar := range dVars {
+			if !isSingleWord(dVar) {
+				continue
+			}
+			reverse := !isOneWay(dic, oneWay, dTerm, dVar)
+			for _, variation := range analyzeTerm(analyzer, dVar) {
+				for _, term := range terms {
+					if variation != term {
+						relations.Expansions[term] = append(relations.Expansions[term], variation)
+						if reverse {
+							relations.Expansions[variation] = append(relations.Expansions[variation], term)
+						}
+					}
+				}
+			}
+		}
+		counter++
+	}
+	return counter
+}
+
+// Основы вариантов из словарей для слов подготовленного запроса (нужны для подсветки)
+func expansionStems(preparedWords []PreparedWord, expansions map[string][]string) []string {
+	result := []string{}
+	for _, stem := range preparedStems(preparedWords) {
+		result = append(result, expansions[stem]...)
+	}
+	return result
+}
+
+// Ключ фразы — основы её слов через пробел; стоп-слова пропускаются
+func phraseKey(phrase string, analyzer Analyzer) string {
+	stems := []string{}
+	for _, word := range tokenize(phrase) {
+		if terms := analyzeTerm(analyzer, word); len(terms) > 0 {
+			stems = append(stems, terms[0])
+		}
+	}
+	return strings.Join(stems, " ")
+}
+
+func (relations *DictionaryRelations) addPhrase(from string, to string, analyzer Analyzer) {
+	key := phraseKey(from, analyzer)
+	if key == "" || len(tokenize(to)) == 0 {
+		return
+	}
+	relations.Phrases[key] = append(relations.Phrases[key], to)
+	if size := len(strings.Split(key, " ")); size > relations.PhraseMaxSize {
+		relations.PhraseMaxSize = size
+	}
+}
+
+// Добавляет пары, в которых термин или вариант состоит из нескольких слов (в обе стороны)
+func (relations *DictionaryRelations) addPhrases(dic Dictionary, oneWay map[string]struct{}, analyzer Analyzer) int {
+	counter := 0
+	for dTerm, dVars := range dic {
+		added := false
+		for _, dVar := range dVars {
+			if len(tokenize(dTerm)) > 1 || len(tokenize(dVar)) > 1 {
+				relations.addPhrase(dTerm, dVar, analyzer)
+				if !isOneWay(dic, oneWay, dTerm, dVar) {
+					relations.addPhrase(dVar, dTerm, analyzer)
+				}
+				added = true
+			}
+		}
+		if added {
+			counter++
+		}
+	}
+	return counter
+}
+
+// Дополняет запрос эквивалентными фразами из словарей: «адаптивный дизайн» → «adaptive+design»
+func (relations DictionaryRelations) expandPhrases(searchRequest string, analyzer Analyzer) string {
+	words := strings.Split(searchRequest, " ")
+	expanded := append([]string{}, words...)
+	for i := range words {
+		for j := i + 1; j <= len(words) && j-i <= relations.PhraseMaxSize; j++ {
+			if strings.ContainsAny(words[j-1], "+-") {
+				break
+			}
+			for _, phrase := range relations.Phrases[phraseKey(strings.Join(words[i:j], " "), analyzer)] {
+				expanded = append(expanded, strings.Join(tokenize(phrase), "+"))
+			}
+		}
+	}
+	return strings.Join(expanded, " ")
+}
+
+// Основы одного слова запроса; для фраз с операторами и нескольких слов основ нет
+func wordStems(word string, analyzer Analyzer) []string {
+	if strings.ContainsAny(word, "+-") {
+		return nil
+	}
+	tokens := tokenize(word)
+	if len(tokens) != 1 {
+		return nil
+	}
+	return analyzeTerm(analyzer, tokens[0])
+}
+
+// Варианты запроса «возможно, вы имели в виду», в которых одно из слов заменено на пароним из индекса
+func (relations DictionaryRelations) suggestions(searchRequest string, stemStat StemStat, analyzer Analyzer) []string {
+	result := []string{}
+	seen := make(map[string]struct{})
+	words := strings.Split(searchRequest, " ")
+	for i, word := range words {
+		for _, stem := range wordStems(word, analyzer) {
+			for _, paronym := range relations.Paronyms[stem] {
+				if !stemStat.containsAny(analyzeTerm(analyzer, paronym)) {
+					continue
+				}
+				suggestion := append(append(append([]string{}, words[:i]...), paronym), words[i+1:]...)
+				joined := strings.Join(suggestion, " ")
+				if _, ok := seen[joined]; !ok {
+					seen[joined] = struct{}{}
+					result = append(result, joined)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func (stemStat StemStat) containsAny(stems []string) bool {
+	for _, stem := range stems {
+		if _, ok := stemStat[stem]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Основы антонимов слов запроса, документы с которыми исключаются из результатов
+func (relations DictionaryRelations) antonymStems(searchRequest string, analyzer Analyzer) []string {
+	result := []string{}
+	for _, word := range strings.Split(searchRequest, " ") {
+		for _, stem := range wordStems(word, analyzer) {
+			for _, antonym := range relations.Antonyms[stem] {
+				result = appendUnique(result, wordStems(antonym, analyzer))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+const DIVERSIFY_NONE string = "none"
+const DIVERSIFY_ROUND_ROBIN string = "round-robin"
+const DIVERSIFY_MMR string = "mmr"
+
+// Раздел документа для разнообразия выдачи: категория и первый тег
+type docSection struct {
+	category string
+	tag      string
+}
+
+func sectionOf(stat DocStat) docSection {
+	section := docSection{category: stat.DocCategory}
+	if len(stat.DocTags) > 0 {
+		section.tag = stat.DocTags[0]
+	}
+	return section
+}
+
+// Порядок хитов после жадного выбора: на каждом шаге берётся документ с наибольшей нормированной частотностью
+// за вычетом штрафа за похожесть на уже выбранные, умноженного на силу разнообразия.
+// При round-robin штраф — число уже выбранных документов из того же раздела, при mmr — наибольшее сходство
+// с выбранными: 1 для того же раздела, 0.5 для той же категории или того же первого тега
+func diversify(stats []DocStat, constants map[string]string) []int {
+	order := make([]int, len(stats))
+	for i := range order {
+		order[i] = i
+	}
+	mode := constants[ARG_DIVERSIFY_MODE]
+	strength, _ := strconv.ParseFloat(constants[ARG_DIVERSIFY_STRENGTH], 64)
+	if mode == DIVERSIFY_NONE || mode == "" || strength <= 0 || len(stats) < 3 {
+		return order
+	}
+	maxFrequency := 0.0
+	for _, s := range stats {
+		maxFrequency = math.Max(maxFrequency, s.DocFrequency)
+	}
+	if maxFrequency <= 0 {
+		return order
+	}
+	sections := make(map[docSection]int)
+	categories := make(map[string]struct{})
+	tags := make(map[string]struct{})
+	penalty := func(section docSection) float64 {
+		if mode == DIVERSIFY_ROUND_ROBIN {
+			return float64(sections[section])
+		}
+		if sections[section] > 0 {
+			return 1
+		}
+		_, sameCategory := categories[section.category]
+		_, sameTag := tags[section.tag]
+		if sameCategory || (sameTag && section.tag != "") {
+			return 0.5
+		}
+		return 0
+	}
+	remaining := order
+	result := make([]int, 0, len(stats))
+	for len(remaining) > 0 {
+		chosen, chosenScore := 0, 0.0
+		for i, position := range remaining {
+			score := stats[position].DocFrequency/maxFrequency - strength*penalty(sectionOf(stats[position]))
+			if i == 0 || score > chosenScore {
+				chosen, chosenScore = i, score
+			}
+		}
+		section := sectionOf(stats[remaining[chosen]])
+		sections[section]++
+		categories[section.category] = struct{}{}
+		tags[section.tag] = struct{}{}
+		result = append(result, remaining[chosen])
+		remaining = append(remaining[:chosen], remaining[chosen+1:]...)
+	}
+	return result
+}
+
+func reorderHits(hits []Hit, order []int) []Hit {
+	result := make([]Hit, 0, len(hits))
+	for _, position := range order {
+		result = append(result, hits[position])
+	}
+	return result
+}
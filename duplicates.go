@@ -0,0 +1,278 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Абзацы короче этого числа терминов не сравниваются: короткие фразы совпадают слишком часто
+const DUPLICATES_PARAGRAPH_MIN_TOKENS int = 8
+
+// Слова текста объединяются в цепочки по три, чтобы отпечаток отражал текст, а не только набор слов
+const DUPLICATES_SHINGLE_SIZE int = 3
+
+// Ключ корзины при поиске близких отпечатков не короче 16 битов: при более коротких ключах в одну корзину
+// попадает слишком много далёких отпечатков и сравнение становится почти попарным
+const DUPLICATES_KEY_MIN_BITS int = 16
+
+// При большем расстоянии сочетаний частей отпечатка становится слишком много
+const DUPLICATES_MAX_DISTANCE int = 8
+
+type ParagraphFingerprint struct {
+	DocIndex  int
+	Paragraph int
+	Hash      uint64
+}
+
+// Отпечатки SimHash документов и абзацев, которые вычисляются при построении индекса
+type Fingerprints struct {
+	Documents  map[int]uint64
+	Paragraphs []ParagraphFingerprint
+}
+
+func newFingerprints() *Fingerprints {
+	return &Fingerprints{Documents: make(map[int]uint64)}
+}
+
+// SimHash цепочек терминов: каждый бит — знак суммы соответствующих битов хэшей всех цепочек
+func simHash(tokens []string) (uint64, bool) {
+	if len(tokens) < DUPLICATES_SHINGLE_SIZE {
+		return 0, false
+	}
+	var weights [64]int
+	for i := 0; i+DUPLICATES_SHINGLE_SIZE <= len(tokens); i++ {
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(tokens[i:i+DUPLICATES_SHINGLE_SIZE], " ")))
+		sum := hash.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var result uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			result |= 1 << uint(bit)
+		}
+	}
+	return result, true
+}
+
+func (fingerprints *Fingerprints) add(docIndex int, paragraphs [][]string) {
+	all := []string{}
+	for paragraph, tokens := range paragraphs {
+		all = append(all, tokens...)
+		if len(tokens) < DUPLICATES_PARAGRAPH_MIN_TOKENS {
+			continue
+		}
+		if hash, ok := simHash(tokens); ok {
+			fingerprints.Paragraphs = append(fingerprints.Paragraphs, ParagraphFingerprint{docIndex, paragraph, hash})
+		}
+	}
+	if hash, ok := simHash(all); ok {
+		fingerprints.Documents[docIndex] = hash
+	}
+}
+
+// Пары отпечатков, различающихся не больше чем в distance битах. Отпечаток делится на distance + k частей:
+// у таких пар совпадают хотя бы k частей, поэтому для каждого сочетания из k частей отпечатки раскладываются
+// по значению этих частей и сравниваются только внутри одной корзины. k выбирается так, чтобы ключ корзины
+// был не короче DUPLICATES_KEY_MIN_BITS битов и в одну корзину попадали только близкие отпечатки
+func similarHashes(hashes []uint64, distance int) [][2]int {
+	pairs := [][2]int{}
+	seen := make(map[[2]int]struct{})
+	compare := func(bucket []int) {
+		for i := 0; i < len(bucket); i++ {
+			for j := i + 1; j < len(bucket); j++ {
+				pair := [2]int{bucket[i], bucket[j]}
+				if _, ok := seen[pair]; ok {
+					continue
+				}
+				seen[pair] = struct{}{}
+				if bits.OnesCount64(hashes[pair[0]]^hashes[pair[1]]) <= distance {
+					pairs = append(pairs, pair)
+				}
+			}
+		}
+	}
+	if distance > DUPLICATES_MAX_DISTANCE {
+		// Сочетаний частей слишком много, быстрее сравнить все отпечатки попарно
+		all := make([]int, len(hashes))
+		for i := range hashes {
+			all[i] = i
+		}
+		compare(all)
+	} else {
+		keyParts := 1
+		for keyParts*(64/(distance+keyParts)) < DUPLICATES_KEY_MIN_BITS {
+			keyParts++
+		}
+		parts := distance + keyParts
+		masks := make([]uint64, parts)
+		for part := range masks {
+			from, to := part*64/parts, (part+1)*64/parts
+			masks[part] = ^uint64(0)
+			if to-from < 64 {
+				masks[part] = (uint64(1)<<uint(to-from) - 1) << uint(from)
+			}
+		}
+		combination := make([]int, keyParts)
+		for i := range combination {
+			combination[i] = i
+		}
+		for {
+			mask := uint64(0)
+			for _, part := range combination {
+				mask |= masks[part]
+			}
+			buckets := make(map[uint64][]int)
+			for i, hash := range hashes {
+				buckets[hash&mask] = append(buckets[hash&mask], i)
+			}
+			for _, bucket := range buckets {
+				compare(bucket)
+			}
+			// Следующее сочетание частей в лексикографическом порядке
+			i := keyParts - 1
+			for i >= 0 && combination[i] == parts-keyParts+i {
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			combination[i]++
+			for j := i + 1; j < keyParts; j++ {
+				combination[j] = combination[j-1] + 1
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
+
+type DocumentDuplicate struct {
+	First    string `json:"first"`
+	Second   string `json:"second"`
+	Distance int    `json:"distance"`
+}
+
+// Номера абзацев — индексы в массиве content документа
+type ParagraphDuplicate struct {
+	First           string `json:"first"`
+	FirstParagraph  int    `json:"firstParagraph"`
+	Second          string `json:"second"`
+	SecondParagraph int    `json:"secondParagraph"`
+	Distance        int    `json:"distance"`
+}
+
+// Почти одинаковые документы и абзацы разных документов
+type DuplicateReport struct {
+	Documents  []DocumentDuplicate  `json:"documents"`
+	Paragraphs []ParagraphDuplicate `json:"paragraphs"`
+	// Документ → документ с меньшим номером из той же группы почти одинаковых
+	groups map[int]int
+}
+
+func findDuplicates(fingerprints *Fingerprints, docs []Document, constants map[string]string) *DuplicateReport {
+	report := &DuplicateReport{Documents: []DocumentDuplicate{}, Paragraphs: []ParagraphDuplicate{}, groups: make(map[int]int)}
+	distance, _ := strconv.Atoi(constants[ARG_DUPLICATES_DISTANCE])
+	if distance < 0 || fingerprints == nil {
+		return report
+	}
+	docIndices := make([]int, 0, len(fingerprints.Documents))
+	for docIndex := range fingerprints.Documents {
+		docIndices = append(docIndices, docIndex)
+	}
+	sort.Ints(docIndices)
+	hashes := make([]uint64, len(docIndices))
+	for i, docIndex := range docIndices {
+		hashes[i] = fingerprints.Documents[docIndex]
+	}
+	for _, pair := range similarHashes(hashes, distance) {
+		first, second := docIndices[pair[0]], docIndices[pair[1]]
+		report.Documents = append(report.Documents, DocumentDuplicate{
+			First:    docs[first].ObjectId,
+			Second:   docs[second].ObjectId,
+			Distance: bits.OnesCount64(hashes[pair[0]] ^ hashes[pair[1]]),
+		})
+		report.union(first, second)
+	}
+	hashes = make([]uint64, len(fingerprints.Paragraphs))
+	for i, p := range fingerprints.Paragraphs {
+		hashes[i] = p.Hash
+	}
+	for _, pair := range similarHashes(hashes, distance) {
+		first, second := fingerprints.Paragraphs[pair[0]], fingerprints.Paragraphs[pair[1]]
+		// Абзацы одного документа и абзацы почти одинаковых документов уже учтены выше
+		if first.DocIndex == second.DocIndex || report.group(first.DocIndex) == report.group(second.DocIndex) {
+			continue
+		}
+		report.Paragraphs = append(report.Paragraphs, ParagraphDuplicate{
+			First:           docs[first.DocIndex].ObjectId,
+			FirstParagraph:  first.Paragraph,
+			Second:          docs[second.DocIndex].ObjectId,
+			SecondParagraph: second.Paragraph,
+			Distance:        bits.OnesCount64(first.Hash ^ second.Hash),
+		})
+	}
+	return report
+}
+
+func (report *DuplicateReport) group(docIndex int) int {
+	if group, ok := report.groups[docIndex]; ok && group != docIndex {
+		return report.group(group)
+	}
+	return docIndex
+}
+
+func (report *DuplicateReport) union(first int, second int) {
+	a, b := report.group(first), report.group(second)
+	if a > b {
+		a, b = b, a
+	}
+	if a != b {
+		report.groups[b] = a
+	}
+}
+
+func (report *DuplicateReport) log() {
+	for _, d := range report.Documents {
+		log.Printf("Документы '%s' и '%s' почти одинаковые (различаются битов отпечатка: %d)", d.First, d.Second, d.Distance)
+	}
+	for _, d := range report.Paragraphs {
+		log.Printf("Абзац %d документа '%s' почти совпадает с абзацем %d документа '%s'", d.FirstParagraph+1, d.First, d.SecondParagraph+1, d.Second)
+	}
+	if len(report.Documents) > 0 || len(report.Paragraphs) > 0 {
+		log.Printf("Найдено почти одинаковых пар документов: %d, пар абзацев: %d", len(report.Documents), len(report.Paragraphs))
+	}
+}
+
+// Оставляет в порядке хитов только первый документ из каждой группы почти одинаковых
+func (report *DuplicateReport) collapse(stats []DocStat, order []int) []int {
+	if report == nil || len(report.groups) == 0 {
+		return order
+	}
+	result := []int{}
+	shown := make(map[int]struct{})
+	for _, position := range order {
+		group := report.group(stats[position].DocIndex)
+		if _, ok := shown[group]; ok {
+			continue
+		}
+		shown[group] = struct{}{}
+		result = append(result, position)
+	}
+	return result
+}
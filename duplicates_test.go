@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	text := strings.Fields("гриды позволяют строить двумерную сетку из колонок и рядов и размещать в ней элементы страницы")
+	changed := append([]string{}, text...)
+	changed[len(changed)-1] = "сайта"
+	other := strings.Fields("метод map создаёт новый массив с результатами вызова функции для каждого элемента исходного массива")
+
+	if _, ok := simHash(text[:DUPLICATES_SHINGLE_SIZE-1]); ok {
+		t.Error("text shorter than a shingle should have no fingerprint")
+	}
+	first, _ := simHash(text)
+	second, _ := simHash(append([]string{}, text...))
+	if first != second {
+		t.Errorf("same text: %x != %x", first, second)
+	}
+	near, _ := simHash(changed)
+	far, _ := simHash(other)
+	if d := bits.OnesCount64(first ^ near); d > 12 {
+		t.Errorf("one changed word: distance %d", d)
+	}
+	if d := bits.OnesCount64(first ^ far); d <= 12 {
+		t.Errorf("different texts: distance %d", d)
+	}
+}
+
+// Разбиение на части не должно терять пары: результат совпадает с попарным сравнением
+func TestSimilarHashes(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	hashes := []uint64{}
+	for i := 0; i < 40; i++ {
+		hash := random.Uint64()
+		hashes = append(hashes, hash)
+		for flips := 1; flips <= 6; flips += 2 {
+			near := hash
+			for _, bit := range random.Perm(64)[:flips] {
+				near ^= 1 << uint(bit)
+			}
+			hashes = append(hashes, near)
+		}
+	}
+	for _, distance := range []int{0, 1, 3, 5, 6, 8, 10, 70} {
+		want := [][2]int{}
+		for i := range hashes {
+			for j := i + 1; j < len(hashes); j++ {
+				if bits.OnesCount64(hashes[i]^hashes[j]) <= distance {
+					want = append(want, [2]int{i, j})
+				}
+			}
+		}
+		if got := similarHashes(hashes, distance); !reflect.DeepEqual(got, want) {
+			t.Errorf("distance %d: got %d pairs, want %d", distance, len(got), len(want))
+		}
+	}
+}
+
+func TestFindDuplicatesAndCollapse(t *testing.T) {
+	paragraph := "гриды позволяют строить двумерную сетку из колонок и рядов и размещать в ней элементы страницы"
+	docs := []Document{
+		{ObjectId: "css/grid", Content: []string{paragraph}},
+		{ObjectId: "css/flex", Content: []string{"флексбокс раскладывает элементы в одну строку или колонку и распределяет между ними свободное место"}},
+		{ObjectId: "css/grid-copy", Content: []string{paragraph}},
+		{ObjectId: "css/layout", Content: []string{"раскладки страницы бывают разными", paragraph}},
+	}
+	fingerprints := newFingerprints()
+	for i, doc := range docs {
+		paragraphs := [][]string{}
+		for _, p := range doc.Content {
+			paragraphs = append(paragraphs, strings.Fields(p))
+		}
+		fingerprints.add(i, paragraphs)
+	}
+	report := findDuplicates(fingerprints, docs, map[string]string{ARG_DUPLICATES_DISTANCE: "3"})
+	if want := []DocumentDuplicate{{"css/grid", "css/grid-copy", 0}}; !reflect.DeepEqual(report.Documents, want) {
+		t.Errorf("documents: got %+v, want %+v", report.Documents, want)
+	}
+	if want := []ParagraphDuplicate{{"css/grid", 0, "css/layout", 1, 0}, {"css/grid-copy", 0, "css/layout", 1, 0}}; !reflect.DeepEqual(report.Paragraphs, want) {
+		t.Errorf("paragraphs: got %+v, want %+v", report.Paragraphs, want)
+	}
+
+	stats := []DocStat{{DocIndex: 2}, {DocIndex: 1}, {DocIndex: 0}, {DocIndex: 3}}
+	if got := report.collapse(stats, []int{0, 1, 2, 3}); !reflect.DeepEqual(got, []int{0, 1, 3}) {
+		t.Errorf("collapse: got %v", got)
+	}
+	disabled := findDuplicates(fingerprints, docs, map[string]string{ARG_DUPLICATES_DISTANCE: "-1"})
+	if got := disabled.collapse(stats, []int{0, 1, 2, 3}); !reflect.DeepEqual(got, []int{0, 1, 2, 3}) {
+		t.Errorf("collapse without duplicates: got %v", got)
+	}
+}
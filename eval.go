@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+)
+
+// Оценки релевантности: поисковая фраза → objectID документа → оценка (0 — нерелевантный документ).
+// Если фраза начинается с `?`, она разбирается как строка параметров запроса, например `?search=grid&category=css`
+type Judgments map[string]map[string]float64
+
+// Метрики качества выдачи по одному запросу
+type QueryMetrics struct {
+	Precision float64
+	Mrr       float64
+	Ndcg      float64
+}
+
+func loadJudgments(path string) (Judgments, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	judgments := Judgments{}
+	if err := json.Unmarshal(content, &judgments); err != nil {
+		return nil, err
+	}
+	return judgments, nil
+}
+
+// Настройки для сравнения: текущие настройки, переопределённые значениями из файла в формате `.env`
+func loadCompareSettings(constants map[string]string, path string) (map[string]string, error) {
+	overrides, err := godotenv.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(constants))
+	for key, value := range constants {
+		result[key] = value
+	}
+	for key, value := range overrides {
+		if _, ok := constants[key]; !ok {
+			log.Printf("Неизвестная настройка '%s' в файле '%s'", key, path)
+			continue
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func judgmentRequest(query string) (*http.Request, error) {
+	if strings.HasPrefix(query, "?") {
+		return http.NewRequest("GET", "/"+query, nil)
+	}
+	return http.NewRequest("GET", "/?search="+url.QueryEscape(query), nil)
+}
+
+// Метрики по первым k хитам: доля релевантных, обратный ранг первого релевантного и NDCG с выигрышем 2^оценка − 1
+func computeMetrics(links []string, grades map[string]float64, k int) QueryMetrics {
+	metrics := QueryMetrics{}
+	dcg := 0.0
+	for i, link := range links {
+		if i >= k {
+			break
+		}
+		grade := grades[link]
+		if grade <= 0 {
+			continue
+		}
+		metrics.Precision++
+		if metrics.Mrr == 0 {
+			metrics.Mrr = 1 / float64(i+1)
+		}
+		dcg += (math.Pow(2, grade) - 1) / math.Log2(float64(i+2))
+	}
+	metrics.Precision /= float64(k)
+	ideal := []float64{}
+	for _, grade := range grades {
+		if grade > 0 {
+			ideal = append(ideal, grade)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(ideal)))
+	idcg := 0.0
+	for i, grade := range ideal {
+		if i >= k {
+			break
+		}
+		idcg += (math.Pow(2, grade) - 1) / math.Log2(float64(i+2))
+	}
+	if idcg > 0 {
+		metrics.Ndcg = dcg / idcg
+	}
+	return metrics
+}
+
+// Выполняет запросы из оценок так же, как обработчик поиска: с правилами, словарями и ранжированием из настроек
+func evaluateSettings(judgments Judgments, queries []string, constants map[string]string) map[string]QueryMetrics {
+	docs, err := loadDocuments(constants[ARG_SEARCH_CONTENT])
+	if err != nil {
+		log.Fatalf("Не могу загрузить документы: %s", err)
+	}
+	stopWords, _ := loadStopWords(constants[ARG_STOP_WORDS])
+	rules, err := loadRules(constants[ARG_RULES_FILE])
+	if err != nil {
+		log.Fatalf("Не могу загрузить правила из файла '%s': %s", constants[ARG_RULES_FILE], err)
+	}
+	setRules(rules)
+	index, err := buildIndex(docs, stopWords, constants)
+	if err != nil {
+		log.Fatal(err.(SearchError).What)
+	}
+	k, _ := strconv.Atoi(constants[ARG_EVAL_K])
+	result := make(map[string]QueryMetrics)
+	for _, phrase := range queries {
+		r, err := judgmentRequest(phrase)
+		if err != nil {
+			log.Fatalf("Не могу разобрать запрос '%s': %s", phrase, err)
+		}
+		query, err := parseSearchQuery(r, index, constants, false)
+		if err != nil {
+			log.Printf("Запрос '%s' пропущен: %s", phrase, err.(SearchError).What)
+			continue
+		}
+		hits, err := getHits(context.Background(), strings.Split(query.Phrase, " "), index.Documents, index.Stems, index.StemKeys, index.QueryAnalyzer, constants, query.Category, query.Tags, query.Options)
+		if err != nil {
+			log.Fatalf("Не могу выполнить запрос '%s': %s", phrase, err)
+		}
+		links := []string{}
+		for _, hit := range query.Applied.arrange(hits, index.Documents) {
+			links = append(links, strings.TrimPrefix(hit.Link, "/"))
+		}
+		result[phrase] = computeMetrics(links, judgments[phrase], k)
+	}
+	return result
+}
+
+func meanMetrics(metrics map[string]QueryMetrics) QueryMetrics {
+	mean := QueryMetrics{}
+	if len(metrics) == 0 {
+		return mean
+	}
+	for _, m := range metrics {
+		mean.Precision += m.Precision
+		mean.Mrr += m.Mrr
+		mean.Ndcg += m.Ndcg
+	}
+	count := float64(len(metrics))
+	return QueryMetrics{mean.Precision / count, mean.Mrr / count, mean.Ndcg / count}
+}
+
+func formatMetrics(m QueryMetrics) string {
+	return fmt.Sprintf("%.3f\t%.3f\t%.3f", m.Precision, m.Mrr, m.Ndcg)
+}
+
+func formatDelta(baseline QueryMetrics, compared QueryMetrics) string {
+	return fmt.Sprintf("%+.3f\t%+.3f\t%+.3f", compared.Precision-baseline.Precision, compared.Mrr-baseline.Mrr, compared.Ndcg-baseline.Ndcg)
+}
+
+// Команда eval: выводит в stdout метрики качества поиска по каждому запросу из оценок и средние значения,
+// а если задан файл настроек для сравнения — метрики с этими настройками и разницу
+func evaluate(constants map[string]string) {
+	if constants[ARG_EVAL_JUDGMENTS] == "" {
+		log.Fatalf("Не задан файл с оценками релевантности (%s)", ARG_EVAL_JUDGMENTS)
+	}
+	judgments, err := loadJudgments(constants[ARG_EVAL_JUDGMENTS])
+	if err != nil {
+		log.Fatalf("Не могу загрузить оценки релевантности из файла '%s': %s", constants[ARG_EVAL_JUDGMENTS], err)
+	}
+	k, err := strconv.Atoi(constants[ARG_EVAL_K])
+	if err != nil || k < 1 {
+		log.Fatalf("Количество хитов для оценки должно быть положительным числом, получено '%s'", constants[ARG_EVAL_K])
+	}
+	queries := make([]string, 0, len(judgments))
+	for query := range judgments {
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		return compareCollationKeys(collationKey(queries[i]), collationKey(queries[j])) < 0
+	})
+	baseline := evaluateSettings(judgments, queries, constants)
+	var compared map[string]QueryMetrics
+	if constants[ARG_EVAL_COMPARE] != "" {
+		compareSettings, err := loadCompareSettings(constants, constants[ARG_EVAL_COMPARE])
+		if err != nil {
+			log.Fatalf("Не могу загрузить настройки для сравнения из файла '%s': %s", constants[ARG_EVAL_COMPARE], err)
+		}
+		compared = evaluateSettings(judgments, queries, compareSettings)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := fmt.Sprintf("P@%d\tMRR@%d\tNDCG@%d", k, k, k)
+	if compared == nil {
+		fmt.Fprintf(w, "Запрос\t%s\t\n", header)
+	} else {
+		fmt.Fprintf(w, "Запрос\t%s\t%s\t%s\t\n", header, header, header)
+		fmt.Fprintf(w, "\tТекущие\t\t\t%s\t\t\tРазница\t\t\t\n", constants[ARG_EVAL_COMPARE])
+	}
+	for _, query := range queries {
+		m, ok := baseline[query]
+		if !ok {
+			continue
+		}
+		if compared == nil {
+			fmt.Fprintf(w, "%s\t%s\t\n", query, formatMetrics(m))
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", query, formatMetrics(m), formatMetrics(compared[query]), formatDelta(m, compared[query]))
+		}
+	}
+	if compared == nil {
+		fmt.Fprintf(w, "Среднее\t%s\t\n", formatMetrics(meanMetrics(baseline)))
+	} else {
+		fmt.Fprintf(w, "Среднее\t%s\t%s\t%s\t\n", formatMetrics(meanMetrics(baseline)), formatMetrics(meanMetrics(compared)), formatDelta(meanMetrics(baseline), meanMetrics(compared)))
+	}
+	w.Flush()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	grades := map[string]float64{"css/grid": 3, "css/flex": 1, "css/old": 0}
+	tests := []struct {
+		name  string
+		links []string
+		k     int
+		want  QueryMetrics
+	}{
+		{"ideal order", []string{"css/grid", "css/flex"}, 2, QueryMetrics{1, 1, 1}},
+		{"swapped", []string{"css/flex", "css/grid"}, 2, QueryMetrics{1, 1, (1 + 7/math.Log2(3)) / (7 + 1/math.Log2(3))}},
+		{"first relevant second", []string{"css/old", "css/grid", "js/map"}, 3, QueryMetrics{1.0 / 3, 0.5, (7 / math.Log2(3)) / (7 + 1/math.Log2(3))}},
+		{"cut at k", []string{"css/old", "js/map", "css/grid"}, 2, QueryMetrics{0, 0, 0}},
+		{"no hits", []string{}, 5, QueryMetrics{0, 0, 0}},
+		{"fewer relevant than k", []string{"css/grid"}, 5, QueryMetrics{0.2, 1, 7 / (7 + 1/math.Log2(3))}},
+	}
+	for _, tt := range tests {
+		got := computeMetrics(tt.links, grades, tt.k)
+		if math.Abs(got.Precision-tt.want.Precision) > 1e-9 || math.Abs(got.Mrr-tt.want.Mrr) > 1e-9 || math.Abs(got.Ndcg-tt.want.Ndcg) > 1e-9 {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if got := computeMetrics([]string{"css/grid"}, map[string]float64{}, 3); got != (QueryMetrics{}) {
+		t.Errorf("no judgments: got %+v", got)
+	}
+}
+
+// Запросы команды eval не должны попадать в лог поисковых запросов
+func TestGetHitsDoesNotLogSearches(t *testing.T) {
+	index, constants := testIndex(t, cssDocuments)
+	before := len(searchLog)
+	searchLinks(t, index, constants, "grid")
+	if len(searchLog) != before {
+		t.Errorf("getHits added %d records to the search log", len(searchLog)-before)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Наибольшая вложенность скобок и NOT в выражении фильтра
+const FILTER_MAX_DEPTH int = 16
+
+// Выражение фильтра вида `category IN (css, js) AND NOT tags = deprecated AND updatedAt > 2024-01-01`
+type FilterExpression interface {
+	evaluate(index *AttributeIndex) Bitmap
+	String() string
+}
+
+type filterAnd struct {
+	left, right FilterExpression
+}
+
+type filterOr struct {
+	left, right FilterExpression
+}
+
+type filterNot struct {
+	expression FilterExpression
+}
+
+type filterValue struct {
+	text   string
+	quoted bool
+}
+
+type filterComparison struct {
+	attribute string
+	operator  string
+	values    []filterValue
+}
+
+func (e filterAnd) evaluate(index *AttributeIndex) Bitmap {
+	return e.left.evaluate(index).and(e.right.evaluate(index))
+}
+
+func (e filterAnd) String() string {
+	return fmt.Sprintf("(%s AND %s)", e.left, e.right)
+}
+
+func (e filterOr) evaluate(index *AttributeIndex) Bitmap {
+	return e.left.evaluate(index).or(e.right.evaluate(index))
+}
+
+func (e filterOr) String() string {
+	return fmt.Sprintf("(%s OR %s)", e.left, e.right)
+}
+
+func (e filterNot) evaluate(index *AttributeIndex) Bitmap {
+	return index.all().andNot(e.expression.evaluate(index))
+}
+
+func (e filterNot) String() string {
+	return fmt.Sprintf("NOT %s", e.expression)
+}
+
+func (v filterValue) String() string {
+	if v.quoted {
+		return strconv.Quote(v.text)
+	}
+	return v.text
+}
+
+// Значение без кавычек может быть строкой, числом или логическим значением
+func (v filterValue) candidates() []interface{} {
+	candidates := []interface{}{v.text}
+	if v.quoted {
+		return candidates
+	}
+	if number, err := strconv.ParseFloat(v.text, 64); err == nil {
+		candidates = append(candidates, number)
+	}
+	if v.text == "true" || v.text == "false" {
+		candidates = append(candidates, v.text == "true")
+	}
+	return candidates
+}
+
+func (e filterComparison) evaluate(index *AttributeIndex) Bitmap {
+	switch e.operator {
+	case "=", "IN":
+		candidates := []interface{}{}
+		for _, value := range e.values {
+			candidates = append(candidates, value.candidates()...)
+		}
+		return index.equal(e.attribute, candidates)
+	case "!=":
+		return index.all().andNot(index.equal(e.attribute, e.values[0].candidates()))
+	}
+	numbers, value := index.numbers[e.attribute], 0.0
+	if number, err := strconv.ParseFloat(e.values[0].text, 64); err == nil {
+		value = number
+	} else {
+		date, _ := parseUpdatedAt(e.values[0].text)
+		numbers, value = index.dates[e.attribute], float64(date.Unix())
+	}
+	switch e.operator {
+	case ">":
+		return index.between(numbers, value, false, math.Inf(1), true)
+	case ">=":
+		return index.between(numbers, value, true, math.Inf(1), true)
+	case "<":
+		return index.between(numbers, math.Inf(-1), true, value, false)
+	default:
+		return index.between(numbers, math.Inf(-1), true, value, true)
+	}
+}
+
+func (e filterComparison) String() string {
+	if e.operator == "IN" {
+		values := make([]string, len(e.values))
+		for i, value := range e.values {
+			values[i] = value.String()
+		}
+		return fmt.Sprintf("%s IN (%s)", e.attribute, strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", e.attribute, e.operator, e.values[0])
+}
+
+const (
+	filterTokenEnd = iota
+	filterTokenWord
+	filterTokenString
+	filterTokenOperator
+	filterTokenOpen
+	filterTokenClose
+	filterTokenComma
+)
+
+type filterToken struct {
+	kind     int
+	text     string
+	position int
+}
+
+func filterError(position int, format string, args ...interface{}) error {
+	return SearchError{time.Now(), fmt.Sprintf("Ошибка в выражении фильтра (символ %d): %s", position+1, fmt.Sprintf(format, args...))}
+}
+
+func tokenizeFilter(s string) ([]filterToken, error) {
+	runes := []rune(s)
+	tokens := []filterToken{}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{filterTokenOpen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{filterTokenClose, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{filterTokenComma, ",", i})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, filterError(i, "не закрыта кавычка")
+			}
+			tokens = append(tokens, filterToken{filterTokenString, string(runes[i+1 : end]), i})
+			i = end + 1
+		case strings.ContainsRune("=!<>", r):
+			operator := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				operator += "="
+			}
+			if operator == "!" {
+				return nil, filterError(i, "ожидается оператор '!='")
+			}
+			tokens = append(tokens, filterToken{filterTokenOperator, operator, i})
+			i += len([]rune(operator))
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("(),\"'=!<>", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{filterTokenWord, string(runes[start:i]), start})
+		}
+	}
+	return append(tokens, filterToken{filterTokenEnd, "", len(runes)}), nil
+}
+
+type filterParser struct {
+	tokens  []filterToken
+	current int
+	depth   int
+	index   *AttributeIndex
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.current]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.current]
+	if token.kind != filterTokenEnd {
+		p.current++
+	}
+	return token
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == filterTokenWord && strings.ToUpper(token.text) == keyword
+}
+
+func (p *filterParser) parseOr() (FilterExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (FilterExpression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (FilterExpression, error) {
+	if p.isKeyword("NOT") || p.peek().kind == filterTokenOpen {
+		if p.depth == FILTER_MAX_DEPTH {
+			return nil, filterError(p.peek().position, "вложенность скобок и NOT не может быть больше %d", FILTER_MAX_DEPTH)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+	if p.isKeyword("NOT") {
+		p.next()
+		expression, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{expression}, nil
+	}
+	if p.peek().kind == filterTokenOpen {
+		p.next()
+		expression, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != filterTokenClose {
+			return nil, filterError(token.position, "ожидается ')'")
+		}
+		return expression, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseValue() (filterValue, error) {
+	token := p.next()
+	if token.kind != filterTokenWord && token.kind != filterTokenString {
+		return filterValue{}, filterError(token.position, "ожидается значение")
+	}
+	return filterValue{token.text, token.kind == filterTokenString}, nil
+}
+
+func (p *filterParser) parseComparison() (FilterExpression, error) {
+	token := p.next()
+	if token.kind != filterTokenWord {
+		return nil, filterError(token.position, "ожидается название атрибута")
+	}
+	if !p.index.has(token.text) {
+		return nil, filterError(token.position, "неизвестный атрибут '%s'", token.text)
+	}
+	comparison := filterComparison{attribute: token.text}
+	if p.isKeyword("IN") {
+		p.next()
+		comparison.operator = "IN"
+		if open := p.next(); open.kind != filterTokenOpen {
+			return nil, filterError(open.position, "ожидается '(' после IN")
+		}
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			comparison.values = append(comparison.values, value)
+			separator := p.next()
+			if separator.kind == filterTokenClose {
+				break
+			}
+			if separator.kind != filterTokenComma {
+				return nil, filterError(separator.position, "ожидается ',' или ')'")
+			}
+		}
+		return comparison, nil
+	}
+	operator := p.next()
+	if operator.kind != filterTokenOperator {
+		return nil, filterError(operator.position, "ожидается оператор сравнения или IN")
+	}
+	comparison.operator = operator.text
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	comparison.values = []filterValue{value}
+	if comparison.operator != "=" && comparison.operator != "!=" {
+		_, numberErr := strconv.ParseFloat(value.text, 64)
+		_, dateErr := parseUpdatedAt(value.text)
+		if numberErr != nil && dateErr != nil {
+			return nil, filterError(operator.position, "сравнение '%s' возможно только с числом или датой", comparison.operator)
+		}
+	}
+	return comparison, nil
+}
+
+// Разбирает выражение фильтра; пустая строка означает отсутствие фильтра
+func parseFilter(s string, index *AttributeIndex) (FilterExpression, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	parser := &filterParser{tokens: tokens, index: index}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != filterTokenEnd {
+		return nil, filterError(token.position, "лишний текст '%s'", token.text)
+	}
+	return expression, nil
+}
+
+func filterString(filter FilterExpression) string {
+	if filter == nil {
+		return ""
+	}
+	return filter.String()
+}
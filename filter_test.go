@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testAttributeIndex(t *testing.T, documents []Document) *AttributeIndex {
+	taxonomy, err := loadTaxonomy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAttributeIndex(documents, taxonomy)
+}
+
+func TestParseFilter(t *testing.T) {
+	documents := []Document{
+		{ObjectId: "css/grid", Category: "css", Tags: []string{"layout"}, UpdatedAt: "2024-05-01", Attributes: map[string]interface{}{"level": 2.0, "interactive": true}},
+		{ObjectId: "css/float", Category: "css", Tags: []string{"layout", "deprecated"}, UpdatedAt: "2020-01-01", Attributes: map[string]interface{}{"level": 1.0}},
+		{ObjectId: "js/map", Category: "js", Tags: []string{"array"}, UpdatedAt: "2023-03-01", Attributes: map[string]interface{}{"level": 3.0, "interactive": false}},
+	}
+	index := testAttributeIndex(t, documents)
+	tests := []struct {
+		filter string
+		want   string
+		docs   []int
+	}{
+		{"", "", []int{0, 1, 2}},
+		{"category = css", "category = css", []int{0, 1}},
+		{"category IN (css, js) AND NOT tags = deprecated AND updatedAt > 2024-01-01", "((category IN (css, js) AND NOT tags = deprecated) AND updatedAt > 2024-01-01)", []int{0}},
+		{"level >= 2 or tags = deprecated", "(level >= 2 OR tags = deprecated)", []int{0, 1, 2}},
+		{"interactive = true", "interactive = true", []int{0}},
+		{"category != 'css'", "category != \"css\"", []int{2}},
+		{"NOT (level < 2 OR category = js)", "NOT (level < 2 OR category = js)", []int{0}},
+	}
+	for _, tt := range tests {
+		filter, err := parseFilter(tt.filter, index)
+		if err != nil {
+			t.Errorf("%q: %s", tt.filter, err)
+			continue
+		}
+		if got := filterString(filter); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.filter, got, tt.want)
+		}
+		docs := []int{}
+		allowed := index.all()
+		if filter != nil {
+			allowed = filter.evaluate(index)
+		}
+		for i := range documents {
+			if allowed.has(i) {
+				docs = append(docs, i)
+			}
+		}
+		if !reflect.DeepEqual(docs, tt.docs) {
+			t.Errorf("%q: got documents %v, want %v", tt.filter, docs, tt.docs)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	index := testAttributeIndex(t, []Document{{ObjectId: "css/grid", Category: "css", Attributes: map[string]interface{}{"level": 2.0}}})
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{"unknown = 1", "(символ 1): неизвестный атрибут 'unknown'"},
+		{"category = 'css", "(символ 12): не закрыта кавычка"},
+		{"category ! css", "(символ 10): ожидается оператор '!='"},
+		{"(category = css", "(символ 16): ожидается ')'"},
+		{"category IN css", "(символ 13): ожидается '(' после IN"},
+		{"category IN (css js)", "(символ 18): ожидается ',' или ')'"},
+		{"level > high", "(символ 7): сравнение '>' возможно только с числом или датой"},
+		{"category = css css", "(символ 16): лишний текст 'css'"},
+		{strings.Repeat("(", FILTER_MAX_DEPTH+1) + "category = css" + strings.Repeat(")", FILTER_MAX_DEPTH+1), "вложенность скобок и NOT не может быть больше 16"},
+		{strings.Repeat("NOT ", 100000) + "category = css", "вложенность скобок и NOT не может быть больше 16"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilter(tt.filter, index)
+		if err == nil {
+			t.Errorf("%.40q: expected error", tt.filter)
+			continue
+		}
+		if what := err.(SearchError).What; !strings.Contains(what, tt.want) {
+			t.Errorf("%.40q: got %q, want %q", tt.filter, what, tt.want)
+		}
+	}
+	if _, err := parseFilter(strings.Repeat("(", FILTER_MAX_DEPTH)+"category = css"+strings.Repeat(")", FILTER_MAX_DEPTH), index); err != nil {
+		t.Errorf("filter at maximum depth: %s", err)
+	}
+}
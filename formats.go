@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func addVariations(dic Dictionary, term string, variations []string) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return
+	}
+	for _, v := range variations {
+		if v = strings.TrimSpace(v); v != "" && v != term {
+			dic[term] = appendUnique(dic[term], []string{v})
+		}
+	}
+}
+
+// Формат synonyms.txt из Solr: «a, b, c» — равнозначные термины, «a, b => c, d» — явная замена
+func parseSolrSynonyms(r io.Reader) (Dictionary, error) {
+	dic := make(Dictionary)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if parts := strings.Split(line, "=>"); len(parts) == 2 {
+			for _, term := range strings.Split(parts[0], ",") {
+				addVariations(dic, term, strings.Split(parts[1], ","))
+				if term = strings.TrimSpace(term); len(dic[term]) > 0 {
+					dic[DICTIONARY_META_ONE_WAY] = appendUnique(dic[DICTIONARY_META_ONE_WAY], []string{term})
+				}
+			}
+		} else if len(parts) == 1 {
+			terms := strings.Split(line, ",")
+			for _, term := range terms {
+				addVariations(dic, term, terms)
+			}
+		} else {
+			return nil, SearchError{time.Now(), fmt.Sprintf("Некорректное правило в строке %d: '%s'", lineNumber, line)}
+		}
+	}
+	return dic, scanner.Err()
+}
+
+// Простой CSV или TSV: первый столбец — термин, остальные — варианты
+func parseDelimited(r io.Reader, delimiter rune) (Dictionary, error) {
+	dic := make(Dictionary)
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > 1 {
+			addVariations(dic, record[0], record[1:])
+		}
+	}
+	return dic, nil
+}
+
+type affixRule struct {
+	strip     string
+	add       string
+	condition *regexp.Regexp
+}
+
+type affixClass struct {
+	prefix bool
+	cross  bool
+	rules  []affixRule
+}
+
+type hunspellAffixes struct {
+	flagType string
+	classes  map[string]*affixClass
+}
+
+func (affixes hunspellAffixes) splitFlags(flags string) []string {
+	switch affixes.flagType {
+	case "long":
+		result := []string{}
+		runes := []rune(flags)
+		for i := 0; i+1 < len(runes); i += 2 {
+			result = append(result, string(runes[i:i+2]))
+		}
+		return result
+	case "num":
+		return strings.Split(flags, ",")
+	default:
+		return strings.Split(flags, "")
+	}
+}
+
+func loadHunspellAffixes(path string) (hunspellAffixes, error) {
+	affixes := hunspellAffixes{classes: make(map[string]*affixClass)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return affixes, nil
+	}
+	if err != nil {
+		return affixes, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "FLAG":
+			affixes.flagType = fields[1]
+		case "SET":
+			if strings.ToUpper(fields[1]) != "UTF-8" {
+				return affixes, SearchError{time.Now(), fmt.Sprintf("Поддерживается только кодировка UTF-8, указана '%s'", fields[1])}
+			}
+		case "PFX", "SFX":
+			class, ok := affixes.classes[fields[1]]
+			if !ok {
+				if len(fields) < 4 {
+					continue
+				}
+				affixes.classes[fields[1]] = &affixClass{prefix: fields[0] == "PFX", cross: fields[2] == "Y"}
+				continue
+			}
+			if len(fields) < 4 {
+				continue
+			}
+			rule := affixRule{strip: fields[2], add: strings.Split(fields[3], "/")[0]}
+			if rule.strip == "0" {
+				rule.strip = ""
+			}
+			if rule.add == "0" {
+				rule.add = ""
+			}
+			condition := "."
+			if len(fields) > 4 {
+				condition = fields[4]
+			}
+			if class.prefix {
+				condition = "^" + condition
+			} else {
+				condition = condition + "$"
+			}
+			if rule.condition, err = regexp.Compile(condition); err != nil {
+				continue
+			}
+			class.rules = append(class.rules, rule)
+		}
+	}
+	return affixes, scanner.Err()
+}
+
+func (class *affixClass) apply(word string) []string {
+	result := []string{}
+	for _, rule := range class.rules {
+		if !rule.condition.MatchString(word) {
+			continue
+		}
+		if class.prefix && strings.HasPrefix(word, rule.strip) {
+			result = append(result, rule.add+strings.TrimPrefix(word, rule.strip))
+		} else if !class.prefix && strings.HasSuffix(word, rule.strip) {
+			result = append(result, strings.TrimSuffix(word, rule.strip)+rule.add)
+		}
+	}
+	return result
+}
+
+// Список слов Hunspell (.dic): каждое слово связывается со своими формами, полученными по правилам из .aff
+func parseHunspell(r io.Reader, affPath string) (Dictionary, error) {
+	affixes, err := loadHunspellAffixes(affPath)
+	if err != nil {
+		return nil, err
+	}
+	dic := make(Dictionary)
+	scanner := bufio.NewScanner(r)
+	firstLine := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if firstLine {
+			firstLine = false
+			if _, err := fmt.Sscanf(line, "%d", new(int)); err == nil {
+				continue
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := strings.Fields(line)[0]
+		word, flags := entry, ""
+		if i := strings.Index(entry, "/"); i >= 0 {
+			word, flags = entry[:i], entry[i+1:]
+		}
+		forms := []string{}
+		prefixes := []*affixClass{}
+		suffixes := []*affixClass{}
+		for _, flag := range affixes.splitFlags(flags) {
+			if class, ok := affixes.classes[flag]; ok {
+				forms = append(forms, class.apply(word)...)
+				if class.cross && class.prefix {
+					prefixes = append(prefixes, class)
+				} else if class.cross {
+					suffixes = append(suffixes, class)
+				}
+			}
+		}
+		for _, suffix := range suffixes {
+			for _, suffixed := range suffix.apply(word) {
+				for _, prefix := range prefixes {
+					forms = append(forms, prefix.apply(suffixed)...)
+				}
+			}
+		}
+		addVariations(dic, word, forms)
+	}
+	return dic, scanner.Err()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSolrSynonyms(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Dictionary
+	}{
+		{
+			name:  "equivalent terms",
+			input: "флекс, flexbox, флексбокс\n",
+			want: Dictionary{
+				"флекс":     {"flexbox", "флексбокс"},
+				"flexbox":   {"флекс", "флексбокс"},
+				"флексбокс": {"флекс", "flexbox"},
+			},
+		},
+		{
+			name:  "explicit mapping",
+			input: "js, джс => javascript, джаваскрипт",
+			want: Dictionary{
+				"js":                    {"javascript", "джаваскрипт"},
+				"джс":                   {"javascript", "джаваскрипт"},
+				DICTIONARY_META_ONE_WAY: {"js", "джс"},
+			},
+		},
+		{
+			name:  "comments, blank lines and duplicates",
+			input: "# комментарий\n\ngrid, грид\ngrid => грид\n",
+			want: Dictionary{
+				"grid":                  {"грид"},
+				"грид":                  {"grid"},
+				DICTIONARY_META_ONE_WAY: {"grid"},
+			},
+		},
+		{
+			name:  "single term",
+			input: "одинокий\n",
+			want:  Dictionary{},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseSolrSynonyms(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+	if _, err := parseSolrSynonyms(strings.NewReader("a => b => c")); err == nil {
+		t.Errorf("parseSolrSynonyms accepted a rule with two '=>'")
+	}
+}
+
+// Явная замена «a => b» работает только от термина к варианту, а «a, b» — в обе стороны
+func TestSolrSynonymsDirection(t *testing.T) {
+	docs := []Document{
+		{ObjectId: "a", Title: "Alpha", Content: []string{"The alpha channel sets transparency."}},
+		{ObjectId: "b", Title: "Beta", Content: []string{"The beta release is almost ready."}},
+		{ObjectId: "c", Title: "Gamma", Content: []string{"The gamma correction changes brightness."}},
+	}
+	dictionaries := map[string]string{"synonyms-test.txt": "alpha => beta\nbeta, gamma\n"}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"alpha", []string{"/a", "/b"}},
+		{"beta", []string{"/b", "/c"}},
+		{"gamma", []string{"/b", "/c"}},
+	}
+	for _, mode := range []string{DICTS_EXPANSION_INDEX, DICTS_EXPANSION_QUERY} {
+		index, constants := testIndexWithDictionaries(t, docs, dictionaries, map[string]string{ARG_DICTS_EXPANSION_MODE: mode})
+		for _, tt := range tests {
+			links := searchLinks(t, index, constants, tt.query)
+			sort.Strings(links)
+			if !reflect.DeepEqual(links, tt.want) {
+				t.Errorf("%s mode, %q: got %v, want %v", mode, tt.query, links, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseDelimited(t *testing.T) {
+	got, err := parseDelimited(strings.NewReader("# термин,варианты\nanchor,ссылка,якорь\n\"a, b\",ab\nодин\n"), ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Dictionary{
+		"anchor": {"ссылка", "якорь"},
+		"a, b":   {"ab"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CSV: got %v, want %v", got, want)
+	}
+	got, err = parseDelimited(strings.NewReader("grid\tгрид\tсетка\n"), '\t')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Dictionary{"grid": {"грид", "сетка"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("TSV: got %v, want %v", got, want)
+	}
+}
+
+func TestParseHunspell(t *testing.T) {
+	affPath := filepath.Join(t.TempDir(), "test.aff")
+	aff := "SET UTF-8\nSFX A Y 2\nSFX A 0 s .\nSFX A y ies [^aeiou]y\nPFX B Y 1\nPFX B 0 re .\n"
+	if err := ioutil.WriteFile(affPath, []byte(aff), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseHunspell(strings.NewReader("3\nwork/AB\nfly/A\nplain\n"), affPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Dictionary{
+		"work": {"works", "rework", "reworks"},
+		"fly":  {"flys", "flies"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	latin1 := filepath.Join(t.TempDir(), "latin1.aff")
+	if err := ioutil.WriteFile(latin1, []byte("SET ISO8859-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseHunspell(strings.NewReader("word\n"), latin1); err == nil {
+		t.Errorf("parseHunspell accepted an affix file in ISO8859-1")
+	}
+}
@@ -3,6 +3,8 @@ module github.com/doka-guide/search
 go 1.17
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/joho/godotenv v1.4.0
 	github.com/kljensen/snowball v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Поисковый индекс со всеми данными, необходимыми для обработки запросов
+type SearchIndex struct {
+	Generation uint64
+	Id         string
+	Documents  []Document
+	Stems      StemStat
+	StemKeys   []string
+	StopWords  map[string]struct{}
+	Relations  DictionaryRelations
+	// Анализаторы полей документа и объединённый анализатор поисковых запросов
+	Analyzers     FieldAnalyzers
+	QueryAnalyzer Analyzer
+	// Исключения для транслитерации: встроенные и из файла TRANSLIT_EXCEPTIONS
+	Transliterations map[string][]string
+	// Встроенные раскладки клавиатуры и раскладки из папки KEYBOARD_LAYOUTS_DIR
+	KeyboardLayouts []KeyboardLayout
+	Ranking         []RankingSignals
+	Positions       PositionIndex
+	Attributes      *AttributeIndex
+	// Иерархия категорий и связи тегов из файла TAXONOMY_FILE
+	Taxonomy *Taxonomy
+	// Почти одинаковые документы и абзацы, найденные по отпечаткам SimHash
+	Duplicates *DuplicateReport
+	// Поисковые фразы из характерных основ каждого документа для `/related/{objectID}`
+	RelatedPhrases []string
+}
+
+var indexGeneration uint64 = 0
+var currentIndex *SearchIndex = nil
+var currentIndexLock sync.RWMutex
+
+// Ошибки в настройках возвращаются вызывающему: при запуске сервис не стартует,
+// а при перестроении индекса продолжает работать с прежним индексом
+func buildIndex(docs []Document, stopWords map[string]struct{}, constants map[string]string) (*SearchIndex, error) {
+	stems := make(StemStat)
+	languageStopWords, err := loadLanguageStopWords(constants[ARG_STOP_WORDS_LANGS_DIR])
+	if err != nil {
+		return nil, SearchError{time.Now(), fmt.Sprintf("Не могу загрузить словари стоп-слов для языков из папки '%s': %s", constants[ARG_STOP_WORDS_LANGS_DIR], err)}
+	}
+	lists := StopWordLists{Common: stopWords, Languages: languageStopWords}
+	analyzers, queryAnalyzer, err := loadAnalyzers(constants[ARG_ANALYZERS_CONFIG], lists)
+	if err != nil {
+		return nil, SearchError{time.Now(), fmt.Sprintf("Не могу загрузить настройки анализаторов из файла '%s': %s", constants[ARG_ANALYZERS_CONFIG], err)}
+	}
+	layouts, err := loadKeyboardLayouts(constants[ARG_KEYBOARD_LAYOUTS_DIR])
+	if err != nil {
+		return nil, SearchError{time.Now(), fmt.Sprintf("Не могу загрузить раскладки клавиатуры из папки '%s': %s", constants[ARG_KEYBOARD_LAYOUTS_DIR], err)}
+	}
+	positions := make(PositionIndex)
+	var fingerprints *Fingerprints
+	if distance, _ := strconv.Atoi(constants[ARG_DUPLICATES_DISTANCE]); distance >= 0 {
+		fingerprints = newFingerprints()
+	}
+	stems.addToIndex(docs, analyzers, positions, fingerprints, constants)
+	relations, err := stems.applyDictionaries(constants[ARG_DICTS_DIR], queryAnalyzer, constants)
+	if err != nil {
+		return nil, err
+	}
+	index, err := newSearchIndex(docs, stems, stopWords, relations, analyzers, queryAnalyzer, layouts, constants)
+	if err != nil {
+		return nil, err
+	}
+	index.Positions = positions
+	index.Duplicates = findDuplicates(fingerprints, docs, constants)
+	index.Duplicates.log()
+	index.RelatedPhrases = relatedPhrases(stems, len(docs), constants)
+	return index, nil
+}
+
+func newSearchIndex(docs []Document, stems StemStat, stopWords map[string]struct{}, relations DictionaryRelations, analyzers FieldAnalyzers, queryAnalyzer Analyzer, layouts []KeyboardLayout, constants map[string]string) (*SearchIndex, error) {
+	stemKeys := stems.keys()
+	for stem := range relations.Expansions {
+		if _, ok := stems[stem]; !ok {
+			stemKeys = append(stemKeys, stem)
+		}
+	}
+	exceptions := Dictionary{}
+	if constants[ARG_TRANSLIT_EXCEPTIONS] != "" {
+		var err error
+		if exceptions, err = loadDictionary(constants[ARG_TRANSLIT_EXCEPTIONS]); err != nil {
+			log.Printf("Не могу загрузить исключения для транслитерации из файла '%s': %s", constants[ARG_TRANSLIT_EXCEPTIONS], err)
+		}
+	}
+	taxonomy, err := loadTaxonomy(constants[ARG_TAXONOMY_FILE])
+	if err != nil {
+		return nil, SearchError{time.Now(), fmt.Sprintf("Не могу загрузить таксономию из файла '%s': %s", constants[ARG_TAXONOMY_FILE], err)}
+	}
+	return &SearchIndex{
+		Generation:       atomic.AddUint64(&indexGeneration, 1),
+		Id:               computeIndexId(docs, stopWords, constants),
+		Documents:        docs,
+		Stems:            stems,
+		StemKeys:         stemKeys,
+		StopWords:        stopWords,
+		Relations:        relations,
+		Analyzers:        analyzers,
+		QueryAnalyzer:    queryAnalyzer,
+		Transliterations: newTransliterationExceptions(queryAnalyzer, defaultTransliterationExceptions, exceptions),
+		KeyboardLayouts:  layouts,
+		Ranking:          newRankingSignals(docs, constants),
+		Attributes:       newAttributeIndex(docs, taxonomy),
+		Taxonomy:         taxonomy,
+	}, nil
+}
+
+// При расширении запроса во время поиска словари заменяются без перестроения индекса,
+// иначе индекс строится заново, так как варианты из словарей хранятся в нём
+func reloadDictionaries(index *SearchIndex, constants map[string]string) (*SearchIndex, error) {
+	if constants[ARG_DICTS_EXPANSION_MODE] != DICTS_EXPANSION_QUERY {
+		return buildIndex(index.Documents, index.StopWords, constants)
+	}
+	relations, err := index.Stems.applyDictionaries(constants[ARG_DICTS_DIR], index.QueryAnalyzer, constants)
+	if err != nil {
+		return nil, err
+	}
+	reloaded, err := newSearchIndex(index.Documents, index.Stems, index.StopWords, relations, index.Analyzers, index.QueryAnalyzer, index.KeyboardLayouts, constants)
+	if err != nil {
+		return nil, err
+	}
+	reloaded.Positions = index.Positions
+	reloaded.Duplicates = index.Duplicates
+	reloaded.RelatedPhrases = index.RelatedPhrases
+	return reloaded, nil
+}
+
+// Идентификатор поколения индекса зависит только от данных, из которых строится индекс,
+// поэтому совпадает у всех экземпляров сервиса, запущенных с одинаковым контентом и настройками
+func computeIndexId(docs []Document, stopWords map[string]struct{}, constants map[string]string) string {
+	hash := sha1.New()
+	encoder := json.NewEncoder(hash)
+	encoder.Encode(docs)
+	words := make([]string, 0, len(stopWords))
+	for w := range stopWords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	encoder.Encode(words)
+	keys := make([]string, 0, len(constants))
+	for k := range constants {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", k, constants[k])
+	}
+	if files, err := ioutil.ReadDir(constants[ARG_DICTS_DIR]); err == nil {
+		for _, file := range files {
+			content, _ := ioutil.ReadFile(fmt.Sprintf("%s/%s", constants[ARG_DICTS_DIR], file.Name()))
+			fmt.Fprintf(hash, "%s\n", file.Name())
+			hash.Write(content)
+		}
+	}
+	for _, path := range []string{constants[ARG_ANALYZERS_CONFIG], constants[ARG_TRANSLIT_EXCEPTIONS], constants[ARG_TAXONOMY_FILE]} {
+		if content, err := ioutil.ReadFile(path); err == nil {
+			hash.Write(content)
+		}
+	}
+	for _, dir := range []string{constants[ARG_STOP_WORDS_LANGS_DIR], constants[ARG_KEYBOARD_LAYOUTS_DIR]} {
+		if files, err := ioutil.ReadDir(dir); err == nil {
+			for _, file := range files {
+				content, _ := ioutil.ReadFile(fmt.Sprintf("%s/%s", dir, file.Name()))
+				fmt.Fprintf(hash, "%s\n", file.Name())
+				hash.Write(content)
+			}
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func getIndex() *SearchIndex {
+	currentIndexLock.RLock()
+	defer currentIndexLock.RUnlock()
+	return currentIndex
+}
+
+func setIndex(index *SearchIndex) {
+	currentIndexLock.Lock()
+	defer currentIndexLock.Unlock()
+	currentIndex = index
+}
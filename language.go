@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	snowballeng "github.com/kljensen/snowball/english"
+	snowballfra "github.com/kljensen/snowball/french"
+	snowballnor "github.com/kljensen/snowball/norwegian"
+	snowballrus "github.com/kljensen/snowball/russian"
+	snowballspa "github.com/kljensen/snowball/spanish"
+	snowballswe "github.com/kljensen/snowball/swedish"
+)
+
+const LANG_RUSSIAN string = "ru"
+const LANG_UKRAINIAN string = "uk"
+const LANG_BELARUSIAN string = "be"
+const LANG_ENGLISH string = "en"
+
+// Алгоритмы выделения основы слова; для языков без стеммера (например, украинского) слова не изменяются
+var stemmers = map[string]func(word string, stemStopWords bool) string{
+	LANG_RUSSIAN: snowballrus.Stem,
+	LANG_ENGLISH: snowballeng.Stem,
+	"fr":         snowballfra.Stem,
+	"es":         snowballspa.Stem,
+	"sv":         snowballswe.Stem,
+	"no":         snowballnor.Stem,
+}
+
+// Письменность, которой пользуется язык
+var languageScripts = map[string]*unicode.RangeTable{
+	LANG_RUSSIAN:    unicode.Cyrillic,
+	LANG_UKRAINIAN:  unicode.Cyrillic,
+	LANG_BELARUSIAN: unicode.Cyrillic,
+	LANG_ENGLISH:    unicode.Latin,
+	"fr":            unicode.Latin,
+	"es":            unicode.Latin,
+	"sv":            unicode.Latin,
+	"no":            unicode.Latin,
+}
+
+// Латинские буквы, которые выглядят как кириллические, и наоборот
+var latinToCyrillic = strings.NewReplacer(
+	"a", "а", "c", "с", "e", "е", "o", "о", "p", "р", "x", "х", "y", "у", "k", "к",
+	"A", "А", "B", "В", "C", "С", "E", "Е", "H", "Н", "K", "К", "M", "М", "O", "О", "P", "Р", "T", "Т", "X", "Х", "Y", "У",
+)
+var cyrillicToLatin = strings.NewReplacer(
+	"а", "a", "с", "c", "е", "e", "о", "o", "р", "p", "х", "x", "у", "y", "к", "k",
+	"А", "A", "В", "B", "С", "C", "Е", "E", "Н", "H", "К", "K", "М", "M", "О", "O", "Р", "P", "Т", "T", "Х", "X", "У", "Y",
+)
+
+// Стоп-слова: общий словарь и словари для отдельных языков
+type StopWordLists struct {
+	Common    map[string]struct{}
+	Languages map[string]map[string]struct{}
+}
+
+func (lists StopWordLists) contains(token string, lang string) bool {
+	if _, ok := lists.Common[token]; ok {
+		return true
+	}
+	_, ok := lists.Languages[lang][token]
+	return ok
+}
+
+// Загружает словари стоп-слов из файлов вида `<язык>.json`
+func loadLanguageStopWords(dir string) (map[string]map[string]struct{}, error) {
+	result := make(map[string]map[string]struct{})
+	if dir == "" {
+		return result, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) != ".json" {
+			continue
+		}
+		lang := normalizeLanguage(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())))
+		stopWords, err := loadStopWords(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result[lang] = make(map[string]struct{}, len(stopWords))
+		for _, word := range transformLettersFilter(sortedStopWords(stopWords)) {
+			result[lang][word] = struct{}{}
+		}
+	}
+	return result, nil
+}
+
+// «ru-RU», «RU» → «ru»
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+func countScripts(token string) (cyrillic int, latin int) {
+	for _, r := range token {
+		if unicode.Is(unicode.Cyrillic, r) {
+			cyrillic++
+		} else if unicode.Is(unicode.Latin, r) {
+			latin++
+		}
+	}
+	return cyrillic, latin
+}
+
+// Заменяет в слове из разных письменностей похожие буквы на буквы преобладающей письменности
+func normalizeMixedScript(token string) string {
+	cyrillic, latin := countScripts(token)
+	if cyrillic == 0 || latin == 0 {
+		return token
+	}
+	var normalized string
+	if cyrillic >= latin {
+		normalized = latinToCyrillic.Replace(token)
+	} else {
+		normalized = cyrillicToLatin.Replace(token)
+	}
+	if c, l := countScripts(normalized); c > 0 && l > 0 {
+		return token
+	}
+	return normalized
+}
+
+// Определяет язык слова по письменности и характерным буквам; язык документа или запроса
+// используется как подсказка, если он совпадает по письменности
+func detectLanguage(token string, hint string) string {
+	cyrillic, latin := countScripts(token)
+	if cyrillic == 0 && latin == 0 {
+		return hint
+	}
+	if cyrillic >= latin {
+		switch {
+		case strings.ContainsAny(token, "ґєїҐЄЇ"):
+			return LANG_UKRAINIAN
+		case strings.ContainsAny(token, "ўЎ"):
+			return LANG_BELARUSIAN
+		case strings.ContainsAny(token, "іІ"):
+			if strings.ContainsAny(token, "ыэёЫЭЁ") || hint == LANG_BELARUSIAN {
+				return LANG_BELARUSIAN
+			}
+			return LANG_UKRAINIAN
+		}
+		if languageScripts[hint] == unicode.Cyrillic {
+			return hint
+		}
+		return LANG_RUSSIAN
+	}
+	if languageScripts[hint] == unicode.Latin {
+		return hint
+	}
+	return LANG_ENGLISH
+}
+
+func stemWord(word string, hint string) string {
+	word = normalizeMixedScript(word)
+	if stem, ok := stemmers[detectLanguage(word, hint)]; ok {
+		return stem(word, false)
+	}
+	return word
+}
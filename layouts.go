@@ -0,0 +1,124 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Раскладка клавиатуры: символы латинской раскладки и символы на тех же клавишах в национальной раскладке
+type KeyboardLayout struct {
+	Name     string
+	forward  map[rune]rune
+	backward map[rune]rune
+}
+
+// Встроенные раскладки в том же формате, что и раскладки из папки KEYBOARD_LAYOUTS_DIR;
+// строчные буквы дополняются заглавными автоматически
+//
+//go:embed layouts/*.json
+var defaultKeyboardLayouts embed.FS
+
+func newKeyboardLayout(name string, keys map[string]string) KeyboardLayout {
+	layout := KeyboardLayout{Name: name, forward: make(map[rune]rune), backward: make(map[rune]rune)}
+	latinKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		latinKeys = append(latinKeys, key)
+	}
+	// Если на нескольких клавишах один символ, обратно он переводится в первую по порядку
+	sort.Strings(latinKeys)
+	for _, key := range latinKeys {
+		from, _ := utf8.DecodeRuneInString(key)
+		to, _ := utf8.DecodeRuneInString(keys[key])
+		if from == utf8.RuneError || to == utf8.RuneError {
+			continue
+		}
+		layout.add(from, to)
+		if unicode.IsLetter(from) && unicode.IsLetter(to) {
+			layout.add(unicode.ToUpper(from), unicode.ToUpper(to))
+		}
+	}
+	return layout
+}
+
+func (layout KeyboardLayout) add(from rune, to rune) {
+	if _, ok := layout.forward[from]; !ok {
+		layout.forward[from] = to
+	}
+	if _, ok := layout.backward[to]; !ok {
+		layout.backward[to] = from
+	}
+}
+
+// Переводит текст, набранный не в той раскладке; символы, которых нет в раскладке, остаются как есть
+func (layout KeyboardLayout) convert(s string) string {
+	national := 0
+	for _, r := range s {
+		if _, ok := layout.backward[r]; ok && unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) {
+			national++
+		}
+	}
+	mapping := layout.forward
+	if national > 0 {
+		mapping = layout.backward
+	}
+	return strings.Map(func(r rune) rune {
+		if converted, ok := mapping[r]; ok {
+			return converted
+		}
+		return r
+	}, s)
+}
+
+// Загружает встроенные раскладки и раскладки из файлов вида `<название>.json` с объектом «клавиша → символ»
+func loadKeyboardLayouts(dir string) ([]KeyboardLayout, error) {
+	keys := make(map[string]map[string]string)
+	builtin, _ := fs.Sub(defaultKeyboardLayouts, "layouts")
+	if err := readKeyboardLayouts(builtin, keys); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := readKeyboardLayouts(os.DirFS(dir), keys); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	layouts := []KeyboardLayout{}
+	for _, name := range names {
+		layouts = append(layouts, newKeyboardLayout(name, keys[name]))
+	}
+	return layouts, nil
+}
+
+// Файл с названием уже прочитанной раскладки заменяет её
+func readKeyboardLayouts(fsys fs.FS, keys map[string]map[string]string) error {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) != ".json" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return err
+		}
+		layout := make(map[string]string)
+		if err := json.Unmarshal(content, &layout); err != nil {
+			return err
+		}
+		keys[strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))] = layout
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyboardLayouts(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "ru.json"), []byte(`{"q": "я"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("не раскладка"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builtin, err := loadKeyboardLayouts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overridden, err := loadKeyboardLayouts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		layouts []KeyboardLayout
+		layout  string
+		input   string
+		want    string
+	}{
+		{"built-in ru", builtin, "ru", "ghbdtn", "привет"},
+		{"built-in ru back", builtin, "ru", "ПРИВЕТ", "GHBDTN"},
+		{"built-in ru-mac", builtin, "ru-mac", "|krf", "Ёлка"},
+		{"built-in uk", builtin, "uk", "\\fyjr", "ґанок"},
+		{"file replaces built-in", overridden, "ru", "qw", "яw"},
+	}
+	for _, tt := range tests {
+		found := false
+		for _, layout := range tt.layouts {
+			if layout.Name != tt.layout {
+				continue
+			}
+			found = true
+			if got := layout.convert(tt.input); got != tt.want {
+				t.Errorf("%s: convert(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+			}
+		}
+		if !found {
+			t.Errorf("%s: no layout %q", tt.name, tt.layout)
+		}
+	}
+	if _, err := loadKeyboardLayouts(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing directory: expected error")
+	}
+}
@@ -3,22 +3,26 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/joho/godotenv"
-	snowballeng "github.com/kljensen/snowball/english"
-	snowballrus "github.com/kljensen/snowball/russian"
 )
 
 const ARG_SEARCH_CONTENT string = "SEARCH_CONTENT"
@@ -28,6 +32,48 @@ const ARG_APP_NAME string = "APP_NAME"
 const ARG_APP_HOST string = "APP_HOST"
 const ARG_APP_PORT string = "APP_PORT"
 const ARG_APP_LOG_LIMIT string = "APP_LOG_LIMIT"
+const ARG_APP_CACHE_SIZE string = "APP_CACHE_SIZE"
+const ARG_APP_CACHE_MAX_AGE string = "APP_CACHE_MAX_AGE"
+const ARG_APP_RATE_LIMIT string = "APP_RATE_LIMIT"
+const ARG_APP_RATE_BURST string = "APP_RATE_BURST"
+const ARG_APP_TRUSTED_PROXIES string = "APP_TRUSTED_PROXIES"
+const ARG_APP_READ_TIMEOUT string = "APP_READ_TIMEOUT"
+const ARG_APP_WRITE_TIMEOUT string = "APP_WRITE_TIMEOUT"
+const ARG_APP_IDLE_TIMEOUT string = "APP_IDLE_TIMEOUT"
+const ARG_APP_SEARCH_TIMEOUT string = "APP_SEARCH_TIMEOUT"
+const ARG_APP_QUERY_MAX_LENGTH string = "APP_QUERY_MAX_LENGTH"
+const ARG_APP_QUERY_MAX_TERMS string = "APP_QUERY_MAX_TERMS"
+const ARG_APP_ADMIN_TOKEN string = "APP_ADMIN_TOKEN"
+const ARG_STOP_WORDS_DF_THRESHOLD string = "STOP_WORDS_DF_THRESHOLD"
+const ARG_STOP_WORDS_TF_THRESHOLD string = "STOP_WORDS_TF_THRESHOLD"
+const ARG_ANALYZERS_CONFIG string = "ANALYZERS_CONFIG"
+const ARG_STOP_WORDS_LANGS_DIR string = "STOP_WORDS_LANGS_DIR"
+const ARG_TRANSLIT_EXCEPTIONS string = "TRANSLIT_EXCEPTIONS"
+const ARG_KEYBOARD_LAYOUTS_DIR string = "KEYBOARD_LAYOUTS_DIR"
+const ARG_RANKING_POPULARITY_FUNCTION string = "RANKING_POPULARITY_FUNCTION"
+const ARG_RANKING_POPULARITY_WEIGHT string = "RANKING_POPULARITY_WEIGHT"
+const ARG_RANKING_RECENCY_HALF_LIFE string = "RANKING_RECENCY_HALF_LIFE"
+const ARG_RANKING_RECENCY_WEIGHT string = "RANKING_RECENCY_WEIGHT"
+const ARG_RULES_FILE string = "RULES_FILE"
+const ARG_PROXIMITY_WEIGHT string = "PROXIMITY_WEIGHT"
+const ARG_PROXIMITY_WINDOW string = "PROXIMITY_WINDOW"
+const ARG_DIVERSIFY_MODE string = "DIVERSIFY_MODE"
+const ARG_DIVERSIFY_STRENGTH string = "DIVERSIFY_STRENGTH"
+const ARG_TAXONOMY_FILE string = "TAXONOMY_FILE"
+const ARG_RELATED_TERMS string = "RELATED_TERMS"
+const ARG_RELATED_HITS string = "RELATED_HITS"
+const ARG_DUPLICATES_DISTANCE string = "DUPLICATES_DISTANCE"
+const ARG_DUPLICATES_COLLAPSE string = "DUPLICATES_COLLAPSE"
+const ARG_EVAL_JUDGMENTS string = "EVAL_JUDGMENTS"
+const ARG_EVAL_COMPARE string = "EVAL_COMPARE"
+const ARG_EVAL_K string = "EVAL_K"
+const ARG_DICTS_EXPANSION_MODE string = "DICTS_EXPANSION_MODE"
+const ARG_DICTS_EXPANSION_WEIGHT string = "DICTS_EXPANSION_WEIGHT"
+const ARG_CORS_ALLOWED_ORIGINS string = "CORS_ALLOWED_ORIGINS"
+const ARG_CORS_ALLOWED_METHODS string = "CORS_ALLOWED_METHODS"
+const ARG_CORS_ALLOWED_HEADERS string = "CORS_ALLOWED_HEADERS"
+const ARG_CORS_MAX_AGE string = "CORS_MAX_AGE"
+const ARG_CORS_ALLOW_CREDENTIALS string = "CORS_ALLOW_CREDENTIALS"
 
 const ARG_WORDS_MARKER_TAG string = "WORDS_MARKER_TAG"
 const ARG_WORDS_DISTANCE_BETWEEN string = "WORDS_DISTANCE_BETWEEN"
@@ -44,6 +90,48 @@ const APP_NAME string = "SEARCH-DB-LESS"
 const APP_HOST string = ""
 const APP_PORT string = "8080"
 const APP_LOG_LIMIT int = 100
+const APP_CACHE_SIZE int = 1000
+const APP_CACHE_MAX_AGE int = 300
+const APP_RATE_LIMIT float64 = 5.0
+const APP_RATE_BURST int = 20
+const APP_TRUSTED_PROXIES string = ""
+const APP_READ_TIMEOUT int = 5
+const APP_WRITE_TIMEOUT int = 10
+const APP_IDLE_TIMEOUT int = 60
+const APP_SEARCH_TIMEOUT int = 2000
+const APP_QUERY_MAX_LENGTH int = 200
+const APP_QUERY_MAX_TERMS int = 10
+const APP_ADMIN_TOKEN string = ""
+const STOP_WORDS_DF_THRESHOLD float64 = 0.5
+const STOP_WORDS_TF_THRESHOLD float64 = 0.001
+const ANALYZERS_CONFIG string = ""
+const STOP_WORDS_LANGS_DIR string = ""
+const TRANSLIT_EXCEPTIONS string = ""
+const KEYBOARD_LAYOUTS_DIR string = ""
+const RANKING_POPULARITY_FUNCTION string = "log"
+const RANKING_POPULARITY_WEIGHT float64 = 0.5
+const RANKING_RECENCY_HALF_LIFE float64 = 365.0
+const RANKING_RECENCY_WEIGHT float64 = 0.3
+const RULES_FILE string = ""
+const PROXIMITY_WEIGHT float64 = 1.0
+const PROXIMITY_WINDOW int = 5
+const DIVERSIFY_MODE string = "none"
+const DIVERSIFY_STRENGTH float64 = 0.5
+const TAXONOMY_FILE string = ""
+const RELATED_TERMS int = 10
+const RELATED_HITS int = 5
+const DUPLICATES_DISTANCE int = 6
+const DUPLICATES_COLLAPSE bool = false
+const EVAL_JUDGMENTS string = ""
+const EVAL_COMPARE string = ""
+const EVAL_K int = 10
+const DICTS_EXPANSION_MODE string = "index"
+const DICTS_EXPANSION_WEIGHT float64 = 0.5
+const CORS_ALLOWED_ORIGINS string = "*"
+const CORS_ALLOWED_METHODS string = "GET, POST, OPTIONS"
+const CORS_ALLOWED_HEADERS string = "Accept, Content-Type, If-None-Match"
+const CORS_MAX_AGE int = 600
+const CORS_ALLOW_CREDENTIALS bool = false
 const WORDS_MARKER_TAG string = "mark"
 const WORDS_DISTANCE_BETWEEN int = 20
 const WORDS_TRIMMER_PLACEHOLDER string = "..."
@@ -70,6 +158,13 @@ type Document struct {
 	Tags     []string `json:"tags"`
 	Category string   `json:"category"`
 	Content  []string `json:"content"`
+	Lang     string   `json:"lang,omitempty"`
+	// Сигналы ранжирования, не зависящие от поисковой фразы
+	Boost      float64 `json:"boost,omitempty"`
+	UpdatedAt  string  `json:"updatedAt,omitempty"`
+	Popularity float64 `json:"popularity,omitempty"`
+	// Произвольные атрибуты для фильтрации и сортировки: строки, числа, логические значения, даты и массивы
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 type DocStat struct {
@@ -89,6 +184,16 @@ type StemStat map[string][]DocStat
 
 type Dictionary map[string][]string
 
+// Операнд подготовленного запроса: оператор перед ним ('+' или '-', у первого операнда — 0) и варианты основы.
+// Варианты хранятся отдельно, поэтому дефис внутри основы (например, grid-template-columns) не считается оператором
+type QueryOperand struct {
+	Operator byte
+	Variants []string
+}
+
+// Слово подготовленного запроса — его операнды по порядку
+type PreparedWord []QueryOperand
+
 type Hit struct {
 	Title     string   `json:"title"`
 	Link      string   `json:"link"`
@@ -97,6 +202,32 @@ type Hit struct {
 	Category  string   `json:"category"`
 }
 
+type SearchOptions struct {
+	ExcludedStems   []string
+	Expansions      map[string][]string
+	ExpansionWeight float64
+	// Основы из текста документов для вариантов из словарей, добавленных в индекс
+	IndexedVariants map[string][]string
+	// Язык поисковой фразы, если он указан в запросе
+	Language string
+	// Исключения для транслитерации слов запроса
+	Transliterations map[string][]string
+	// Раскладки клавиатуры для исправления слов, набранных не в той раскладке
+	KeyboardLayouts []KeyboardLayout
+	// Множители частотности документов по сигналам ранжирования и дата, на которую посчитано понижение по давности
+	DocumentScores []float64
+	RecencyDate    string
+	// Позиции терминов в документах для оценки близости слов запроса
+	Positions PositionIndex
+	// Поля сортировки вместо порядка по релевантности
+	Sort []SortKey
+	// Индексы атрибутов документов и выражение фильтра из запроса
+	Attributes *AttributeIndex
+	Filter     FilterExpression
+	// Группы почти одинаковых документов
+	Duplicates *DuplicateReport
+}
+
 type LogRecord struct {
 	RequestTime    string
 	RequestHost    string
@@ -144,18 +275,14 @@ func Min3(a int, b int, c int) int {
 	return c
 }
 
-func removeDuplicates(list []int) []int {
-	result := []int{}
-	for _, l := range list {
-		isDuplicated := false
-		for _, r := range result {
-			if r == l {
-				isDuplicated = true
-				break
-			}
-		}
-		if !isDuplicated {
-			result = append(result, l)
+// Оставляет для каждого документа первую, то есть наибольшую, частотность
+func removeDuplicateStats(stats []DocStat) []DocStat {
+	result := []DocStat{}
+	seen := make(map[int]struct{})
+	for _, s := range stats {
+		if _, ok := seen[s.DocIndex]; !ok {
+			seen[s.DocIndex] = struct{}{}
+			result = append(result, s)
 		}
 	}
 	return result
@@ -169,14 +296,6 @@ func removeSpecialSymbolsFromString(str string) string {
 	return str
 }
 
-func getWordStem(word string) string {
-	if strings.ContainsAny(word, "абвгдеёжхзиклмнопрстуфхцчшщьыъэюяАБВГДЕЁЖХЗИКЛМНОПРСТУФХЦЧШЩЬЫЪЭЮЯ") {
-		return snowballrus.Stem(word, false)
-	} else {
-		return snowballeng.Stem(word, false)
-	}
-}
-
 func loadSettings() map[string]string {
 	defer timeTrackLoading(time.Now(), "настроек из файла")
 	var err = godotenv.Load()
@@ -187,6 +306,48 @@ func loadSettings() map[string]string {
 		result[ARG_APP_HOST] = APP_HOST
 		result[ARG_APP_PORT] = APP_PORT
 		result[ARG_APP_LOG_LIMIT] = fmt.Sprintf("%d", APP_LOG_LIMIT)
+		result[ARG_APP_CACHE_SIZE] = fmt.Sprintf("%d", APP_CACHE_SIZE)
+		result[ARG_APP_CACHE_MAX_AGE] = fmt.Sprintf("%d", APP_CACHE_MAX_AGE)
+		result[ARG_APP_RATE_LIMIT] = fmt.Sprintf("%f", APP_RATE_LIMIT)
+		result[ARG_APP_RATE_BURST] = fmt.Sprintf("%d", APP_RATE_BURST)
+		result[ARG_APP_TRUSTED_PROXIES] = APP_TRUSTED_PROXIES
+		result[ARG_APP_READ_TIMEOUT] = fmt.Sprintf("%d", APP_READ_TIMEOUT)
+		result[ARG_APP_WRITE_TIMEOUT] = fmt.Sprintf("%d", APP_WRITE_TIMEOUT)
+		result[ARG_APP_IDLE_TIMEOUT] = fmt.Sprintf("%d", APP_IDLE_TIMEOUT)
+		result[ARG_APP_SEARCH_TIMEOUT] = fmt.Sprintf("%d", APP_SEARCH_TIMEOUT)
+		result[ARG_APP_QUERY_MAX_LENGTH] = fmt.Sprintf("%d", APP_QUERY_MAX_LENGTH)
+		result[ARG_APP_QUERY_MAX_TERMS] = fmt.Sprintf("%d", APP_QUERY_MAX_TERMS)
+		result[ARG_APP_ADMIN_TOKEN] = APP_ADMIN_TOKEN
+		result[ARG_STOP_WORDS_DF_THRESHOLD] = fmt.Sprintf("%f", STOP_WORDS_DF_THRESHOLD)
+		result[ARG_STOP_WORDS_TF_THRESHOLD] = fmt.Sprintf("%f", STOP_WORDS_TF_THRESHOLD)
+		result[ARG_ANALYZERS_CONFIG] = ANALYZERS_CONFIG
+		result[ARG_STOP_WORDS_LANGS_DIR] = STOP_WORDS_LANGS_DIR
+		result[ARG_TRANSLIT_EXCEPTIONS] = TRANSLIT_EXCEPTIONS
+		result[ARG_KEYBOARD_LAYOUTS_DIR] = KEYBOARD_LAYOUTS_DIR
+		result[ARG_RANKING_POPULARITY_FUNCTION] = RANKING_POPULARITY_FUNCTION
+		result[ARG_RANKING_POPULARITY_WEIGHT] = fmt.Sprintf("%f", RANKING_POPULARITY_WEIGHT)
+		result[ARG_RANKING_RECENCY_HALF_LIFE] = fmt.Sprintf("%f", RANKING_RECENCY_HALF_LIFE)
+		result[ARG_RANKING_RECENCY_WEIGHT] = fmt.Sprintf("%f", RANKING_RECENCY_WEIGHT)
+		result[ARG_RULES_FILE] = RULES_FILE
+		result[ARG_PROXIMITY_WEIGHT] = fmt.Sprintf("%f", PROXIMITY_WEIGHT)
+		result[ARG_PROXIMITY_WINDOW] = fmt.Sprintf("%d", PROXIMITY_WINDOW)
+		result[ARG_DIVERSIFY_MODE] = DIVERSIFY_MODE
+		result[ARG_DIVERSIFY_STRENGTH] = fmt.Sprintf("%f", DIVERSIFY_STRENGTH)
+		result[ARG_TAXONOMY_FILE] = TAXONOMY_FILE
+		result[ARG_RELATED_TERMS] = fmt.Sprintf("%d", RELATED_TERMS)
+		result[ARG_RELATED_HITS] = fmt.Sprintf("%d", RELATED_HITS)
+		result[ARG_DUPLICATES_DISTANCE] = fmt.Sprintf("%d", DUPLICATES_DISTANCE)
+		result[ARG_DUPLICATES_COLLAPSE] = fmt.Sprintf("%t", DUPLICATES_COLLAPSE)
+		result[ARG_EVAL_JUDGMENTS] = EVAL_JUDGMENTS
+		result[ARG_EVAL_COMPARE] = EVAL_COMPARE
+		result[ARG_EVAL_K] = fmt.Sprintf("%d", EVAL_K)
+		result[ARG_DICTS_EXPANSION_MODE] = DICTS_EXPANSION_MODE
+		result[ARG_DICTS_EXPANSION_WEIGHT] = fmt.Sprintf("%f", DICTS_EXPANSION_WEIGHT)
+		result[ARG_CORS_ALLOWED_ORIGINS] = CORS_ALLOWED_ORIGINS
+		result[ARG_CORS_ALLOWED_METHODS] = CORS_ALLOWED_METHODS
+		result[ARG_CORS_ALLOWED_HEADERS] = CORS_ALLOWED_HEADERS
+		result[ARG_CORS_MAX_AGE] = fmt.Sprintf("%d", CORS_MAX_AGE)
+		result[ARG_CORS_ALLOW_CREDENTIALS] = fmt.Sprintf("%t", CORS_ALLOW_CREDENTIALS)
 		result[ARG_WORDS_MARKER_TAG] = WORDS_MARKER_TAG
 		result[ARG_WORDS_DISTANCE_BETWEEN] = fmt.Sprintf("%d", WORDS_DISTANCE_BETWEEN)
 		result[ARG_WORDS_TRIMMER_PLACEHOLDER] = WORDS_TRIMMER_PLACEHOLDER
@@ -212,6 +373,90 @@ func loadSettings() map[string]string {
 				result[ARG_APP_PORT] = args[i+1]
 			case "-l", "--app-log":
 				result[ARG_APP_LOG_LIMIT] = args[i+1]
+			case "--app-cache-size":
+				result[ARG_APP_CACHE_SIZE] = args[i+1]
+			case "--app-cache-max-age":
+				result[ARG_APP_CACHE_MAX_AGE] = args[i+1]
+			case "--app-rate-limit":
+				result[ARG_APP_RATE_LIMIT] = args[i+1]
+			case "--app-rate-burst":
+				result[ARG_APP_RATE_BURST] = args[i+1]
+			case "--app-trusted-proxies":
+				result[ARG_APP_TRUSTED_PROXIES] = args[i+1]
+			case "--app-read-timeout":
+				result[ARG_APP_READ_TIMEOUT] = args[i+1]
+			case "--app-write-timeout":
+				result[ARG_APP_WRITE_TIMEOUT] = args[i+1]
+			case "--app-idle-timeout":
+				result[ARG_APP_IDLE_TIMEOUT] = args[i+1]
+			case "--app-search-timeout":
+				result[ARG_APP_SEARCH_TIMEOUT] = args[i+1]
+			case "--app-query-max-length":
+				result[ARG_APP_QUERY_MAX_LENGTH] = args[i+1]
+			case "--app-query-max-terms":
+				result[ARG_APP_QUERY_MAX_TERMS] = args[i+1]
+			case "--app-admin-token":
+				result[ARG_APP_ADMIN_TOKEN] = args[i+1]
+			case "--stop-words-df-threshold":
+				result[ARG_STOP_WORDS_DF_THRESHOLD] = args[i+1]
+			case "--stop-words-tf-threshold":
+				result[ARG_STOP_WORDS_TF_THRESHOLD] = args[i+1]
+			case "--analyzers-config":
+				result[ARG_ANALYZERS_CONFIG] = args[i+1]
+			case "--stop-words-langs-dir":
+				result[ARG_STOP_WORDS_LANGS_DIR] = args[i+1]
+			case "--translit-exceptions":
+				result[ARG_TRANSLIT_EXCEPTIONS] = args[i+1]
+			case "--keyboard-layouts-dir":
+				result[ARG_KEYBOARD_LAYOUTS_DIR] = args[i+1]
+			case "--ranking-popularity-function":
+				result[ARG_RANKING_POPULARITY_FUNCTION] = args[i+1]
+			case "--ranking-popularity-weight":
+				result[ARG_RANKING_POPULARITY_WEIGHT] = args[i+1]
+			case "--ranking-recency-half-life":
+				result[ARG_RANKING_RECENCY_HALF_LIFE] = args[i+1]
+			case "--ranking-recency-weight":
+				result[ARG_RANKING_RECENCY_WEIGHT] = args[i+1]
+			case "--rules-file":
+				result[ARG_RULES_FILE] = args[i+1]
+			case "--proximity-weight":
+				result[ARG_PROXIMITY_WEIGHT] = args[i+1]
+			case "--proximity-window":
+				result[ARG_PROXIMITY_WINDOW] = args[i+1]
+			case "--diversify-mode":
+				result[ARG_DIVERSIFY_MODE] = args[i+1]
+			case "--diversify-strength":
+				result[ARG_DIVERSIFY_STRENGTH] = args[i+1]
+			case "--taxonomy-file":
+				result[ARG_TAXONOMY_FILE] = args[i+1]
+			case "--related-terms":
+				result[ARG_RELATED_TERMS] = args[i+1]
+			case "--related-hits":
+				result[ARG_RELATED_HITS] = args[i+1]
+			case "--duplicates-distance":
+				result[ARG_DUPLICATES_DISTANCE] = args[i+1]
+			case "--duplicates-collapse":
+				result[ARG_DUPLICATES_COLLAPSE] = args[i+1]
+			case "--eval-judgments":
+				result[ARG_EVAL_JUDGMENTS] = args[i+1]
+			case "--eval-compare":
+				result[ARG_EVAL_COMPARE] = args[i+1]
+			case "--eval-k":
+				result[ARG_EVAL_K] = args[i+1]
+			case "--dicts-expansion-mode":
+				result[ARG_DICTS_EXPANSION_MODE] = args[i+1]
+			case "--dicts-expansion-weight":
+				result[ARG_DICTS_EXPANSION_WEIGHT] = args[i+1]
+			case "--cors-allowed-origins":
+				result[ARG_CORS_ALLOWED_ORIGINS] = args[i+1]
+			case "--cors-allowed-methods":
+				result[ARG_CORS_ALLOWED_METHODS] = args[i+1]
+			case "--cors-allowed-headers":
+				result[ARG_CORS_ALLOWED_HEADERS] = args[i+1]
+			case "--cors-max-age":
+				result[ARG_CORS_MAX_AGE] = args[i+1]
+			case "--cors-allow-credentials":
+				result[ARG_CORS_ALLOW_CREDENTIALS] = args[i+1]
 			case "--words-marker-tag":
 				result[ARG_WORDS_MARKER_TAG] = args[i+1]
 			case "--words-distance-between":
@@ -259,6 +504,216 @@ func loadSettings() map[string]string {
 		} else {
 			result[ARG_APP_LOG_LIMIT] = fmt.Sprintf("%d", APP_LOG_LIMIT)
 		}
+		if os.Getenv(ARG_APP_CACHE_SIZE) != "" {
+			result[ARG_APP_CACHE_SIZE] = os.Getenv(ARG_APP_CACHE_SIZE)
+		} else {
+			result[ARG_APP_CACHE_SIZE] = fmt.Sprintf("%d", APP_CACHE_SIZE)
+		}
+		if os.Getenv(ARG_APP_CACHE_MAX_AGE) != "" {
+			result[ARG_APP_CACHE_MAX_AGE] = os.Getenv(ARG_APP_CACHE_MAX_AGE)
+		} else {
+			result[ARG_APP_CACHE_MAX_AGE] = fmt.Sprintf("%d", APP_CACHE_MAX_AGE)
+		}
+		if os.Getenv(ARG_APP_RATE_LIMIT) != "" {
+			result[ARG_APP_RATE_LIMIT] = os.Getenv(ARG_APP_RATE_LIMIT)
+		} else {
+			result[ARG_APP_RATE_LIMIT] = fmt.Sprintf("%f", APP_RATE_LIMIT)
+		}
+		if os.Getenv(ARG_APP_RATE_BURST) != "" {
+			result[ARG_APP_RATE_BURST] = os.Getenv(ARG_APP_RATE_BURST)
+		} else {
+			result[ARG_APP_RATE_BURST] = fmt.Sprintf("%d", APP_RATE_BURST)
+		}
+		if os.Getenv(ARG_APP_TRUSTED_PROXIES) != "" {
+			result[ARG_APP_TRUSTED_PROXIES] = os.Getenv(ARG_APP_TRUSTED_PROXIES)
+		} else {
+			result[ARG_APP_TRUSTED_PROXIES] = APP_TRUSTED_PROXIES
+		}
+		if os.Getenv(ARG_APP_READ_TIMEOUT) != "" {
+			result[ARG_APP_READ_TIMEOUT] = os.Getenv(ARG_APP_READ_TIMEOUT)
+		} else {
+			result[ARG_APP_READ_TIMEOUT] = fmt.Sprintf("%d", APP_READ_TIMEOUT)
+		}
+		if os.Getenv(ARG_APP_WRITE_TIMEOUT) != "" {
+			result[ARG_APP_WRITE_TIMEOUT] = os.Getenv(ARG_APP_WRITE_TIMEOUT)
+		} else {
+			result[ARG_APP_WRITE_TIMEOUT] = fmt.Sprintf("%d", APP_WRITE_TIMEOUT)
+		}
+		if os.Getenv(ARG_APP_IDLE_TIMEOUT) != "" {
+			result[ARG_APP_IDLE_TIMEOUT] = os.Getenv(ARG_APP_IDLE_TIMEOUT)
+		} else {
+			result[ARG_APP_IDLE_TIMEOUT] = fmt.Sprintf("%d", APP_IDLE_TIMEOUT)
+		}
+		if os.Getenv(ARG_APP_SEARCH_TIMEOUT) != "" {
+			result[ARG_APP_SEARCH_TIMEOUT] = os.Getenv(ARG_APP_SEARCH_TIMEOUT)
+		} else {
+			result[ARG_APP_SEARCH_TIMEOUT] = fmt.Sprintf("%d", APP_SEARCH_TIMEOUT)
+		}
+		if os.Getenv(ARG_APP_QUERY_MAX_LENGTH) != "" {
+			result[ARG_APP_QUERY_MAX_LENGTH] = os.Getenv(ARG_APP_QUERY_MAX_LENGTH)
+		} else {
+			result[ARG_APP_QUERY_MAX_LENGTH] = fmt.Sprintf("%d", APP_QUERY_MAX_LENGTH)
+		}
+		if os.Getenv(ARG_APP_QUERY_MAX_TERMS) != "" {
+			result[ARG_APP_QUERY_MAX_TERMS] = os.Getenv(ARG_APP_QUERY_MAX_TERMS)
+		} else {
+			result[ARG_APP_QUERY_MAX_TERMS] = fmt.Sprintf("%d", APP_QUERY_MAX_TERMS)
+		}
+		if os.Getenv(ARG_APP_ADMIN_TOKEN) != "" {
+			result[ARG_APP_ADMIN_TOKEN] = os.Getenv(ARG_APP_ADMIN_TOKEN)
+		} else {
+			result[ARG_APP_ADMIN_TOKEN] = APP_ADMIN_TOKEN
+		}
+		if os.Getenv(ARG_STOP_WORDS_DF_THRESHOLD) != "" {
+			result[ARG_STOP_WORDS_DF_THRESHOLD] = os.Getenv(ARG_STOP_WORDS_DF_THRESHOLD)
+		} else {
+			result[ARG_STOP_WORDS_DF_THRESHOLD] = fmt.Sprintf("%f", STOP_WORDS_DF_THRESHOLD)
+		}
+		if os.Getenv(ARG_STOP_WORDS_TF_THRESHOLD) != "" {
+			result[ARG_STOP_WORDS_TF_THRESHOLD] = os.Getenv(ARG_STOP_WORDS_TF_THRESHOLD)
+		} else {
+			result[ARG_STOP_WORDS_TF_THRESHOLD] = fmt.Sprintf("%f", STOP_WORDS_TF_THRESHOLD)
+		}
+		if os.Getenv(ARG_ANALYZERS_CONFIG) != "" {
+			result[ARG_ANALYZERS_CONFIG] = os.Getenv(ARG_ANALYZERS_CONFIG)
+		} else {
+			result[ARG_ANALYZERS_CONFIG] = ANALYZERS_CONFIG
+		}
+		if os.Getenv(ARG_STOP_WORDS_LANGS_DIR) != "" {
+			result[ARG_STOP_WORDS_LANGS_DIR] = os.Getenv(ARG_STOP_WORDS_LANGS_DIR)
+		} else {
+			result[ARG_STOP_WORDS_LANGS_DIR] = STOP_WORDS_LANGS_DIR
+		}
+		if os.Getenv(ARG_TRANSLIT_EXCEPTIONS) != "" {
+			result[ARG_TRANSLIT_EXCEPTIONS] = os.Getenv(ARG_TRANSLIT_EXCEPTIONS)
+		} else {
+			result[ARG_TRANSLIT_EXCEPTIONS] = TRANSLIT_EXCEPTIONS
+		}
+		if os.Getenv(ARG_KEYBOARD_LAYOUTS_DIR) != "" {
+			result[ARG_KEYBOARD_LAYOUTS_DIR] = os.Getenv(ARG_KEYBOARD_LAYOUTS_DIR)
+		} else {
+			result[ARG_KEYBOARD_LAYOUTS_DIR] = KEYBOARD_LAYOUTS_DIR
+		}
+		if os.Getenv(ARG_RANKING_POPULARITY_FUNCTION) != "" {
+			result[ARG_RANKING_POPULARITY_FUNCTION] = os.Getenv(ARG_RANKING_POPULARITY_FUNCTION)
+		} else {
+			result[ARG_RANKING_POPULARITY_FUNCTION] = RANKING_POPULARITY_FUNCTION
+		}
+		if os.Getenv(ARG_RANKING_POPULARITY_WEIGHT) != "" {
+			result[ARG_RANKING_POPULARITY_WEIGHT] = os.Getenv(ARG_RANKING_POPULARITY_WEIGHT)
+		} else {
+			result[ARG_RANKING_POPULARITY_WEIGHT] = fmt.Sprintf("%f", RANKING_POPULARITY_WEIGHT)
+		}
+		if os.Getenv(ARG_RANKING_RECENCY_HALF_LIFE) != "" {
+			result[ARG_RANKING_RECENCY_HALF_LIFE] = os.Getenv(ARG_RANKING_RECENCY_HALF_LIFE)
+		} else {
+			result[ARG_RANKING_RECENCY_HALF_LIFE] = fmt.Sprintf("%f", RANKING_RECENCY_HALF_LIFE)
+		}
+		if os.Getenv(ARG_RANKING_RECENCY_WEIGHT) != "" {
+			result[ARG_RANKING_RECENCY_WEIGHT] = os.Getenv(ARG_RANKING_RECENCY_WEIGHT)
+		} else {
+			result[ARG_RANKING_RECENCY_WEIGHT] = fmt.Sprintf("%f", RANKING_RECENCY_WEIGHT)
+		}
+		if os.Getenv(ARG_RULES_FILE) != "" {
+			result[ARG_RULES_FILE] = os.Getenv(ARG_RULES_FILE)
+		} else {
+			result[ARG_RULES_FILE] = RULES_FILE
+		}
+		if os.Getenv(ARG_PROXIMITY_WEIGHT) != "" {
+			result[ARG_PROXIMITY_WEIGHT] = os.Getenv(ARG_PROXIMITY_WEIGHT)
+		} else {
+			result[ARG_PROXIMITY_WEIGHT] = fmt.Sprintf("%f", PROXIMITY_WEIGHT)
+		}
+		if os.Getenv(ARG_PROXIMITY_WINDOW) != "" {
+			result[ARG_PROXIMITY_WINDOW] = os.Getenv(ARG_PROXIMITY_WINDOW)
+		} else {
+			result[ARG_PROXIMITY_WINDOW] = fmt.Sprintf("%d", PROXIMITY_WINDOW)
+		}
+		if os.Getenv(ARG_DIVERSIFY_MODE) != "" {
+			result[ARG_DIVERSIFY_MODE] = os.Getenv(ARG_DIVERSIFY_MODE)
+		} else {
+			result[ARG_DIVERSIFY_MODE] = DIVERSIFY_MODE
+		}
+		if os.Getenv(ARG_DIVERSIFY_STRENGTH) != "" {
+			result[ARG_DIVERSIFY_STRENGTH] = os.Getenv(ARG_DIVERSIFY_STRENGTH)
+		} else {
+			result[ARG_DIVERSIFY_STRENGTH] = fmt.Sprintf("%f", DIVERSIFY_STRENGTH)
+		}
+		if os.Getenv(ARG_TAXONOMY_FILE) != "" {
+			result[ARG_TAXONOMY_FILE] = os.Getenv(ARG_TAXONOMY_FILE)
+		} else {
+			result[ARG_TAXONOMY_FILE] = TAXONOMY_FILE
+		}
+		if os.Getenv(ARG_RELATED_TERMS) != "" {
+			result[ARG_RELATED_TERMS] = os.Getenv(ARG_RELATED_TERMS)
+		} else {
+			result[ARG_RELATED_TERMS] = fmt.Sprintf("%d", RELATED_TERMS)
+		}
+		if os.Getenv(ARG_RELATED_HITS) != "" {
+			result[ARG_RELATED_HITS] = os.Getenv(ARG_RELATED_HITS)
+		} else {
+			result[ARG_RELATED_HITS] = fmt.Sprintf("%d", RELATED_HITS)
+		}
+		if os.Getenv(ARG_DUPLICATES_DISTANCE) != "" {
+			result[ARG_DUPLICATES_DISTANCE] = os.Getenv(ARG_DUPLICATES_DISTANCE)
+		} else {
+			result[ARG_DUPLICATES_DISTANCE] = fmt.Sprintf("%d", DUPLICATES_DISTANCE)
+		}
+		if os.Getenv(ARG_DUPLICATES_COLLAPSE) != "" {
+			result[ARG_DUPLICATES_COLLAPSE] = os.Getenv(ARG_DUPLICATES_COLLAPSE)
+		} else {
+			result[ARG_DUPLICATES_COLLAPSE] = fmt.Sprintf("%t", DUPLICATES_COLLAPSE)
+		}
+		if os.Getenv(ARG_EVAL_JUDGMENTS) != "" {
+			result[ARG_EVAL_JUDGMENTS] = os.Getenv(ARG_EVAL_JUDGMENTS)
+		} else {
+			result[ARG_EVAL_JUDGMENTS] = EVAL_JUDGMENTS
+		}
+		if os.Getenv(ARG_EVAL_COMPARE) != "" {
+			result[ARG_EVAL_COMPARE] = os.Getenv(ARG_EVAL_COMPARE)
+		} else {
+			result[ARG_EVAL_COMPARE] = EVAL_COMPARE
+		}
+		if os.Getenv(ARG_EVAL_K) != "" {
+			result[ARG_EVAL_K] = os.Getenv(ARG_EVAL_K)
+		} else {
+			result[ARG_EVAL_K] = fmt.Sprintf("%d", EVAL_K)
+		}
+		if os.Getenv(ARG_DICTS_EXPANSION_MODE) != "" {
+			result[ARG_DICTS_EXPANSION_MODE] = os.Getenv(ARG_DICTS_EXPANSION_MODE)
+		} else {
+			result[ARG_DICTS_EXPANSION_MODE] = DICTS_EXPANSION_MODE
+		}
+		if os.Getenv(ARG_DICTS_EXPANSION_WEIGHT) != "" {
+			result[ARG_DICTS_EXPANSION_WEIGHT] = os.Getenv(ARG_DICTS_EXPANSION_WEIGHT)
+		} else {
+			result[ARG_DICTS_EXPANSION_WEIGHT] = fmt.Sprintf("%f", DICTS_EXPANSION_WEIGHT)
+		}
+		if os.Getenv(ARG_CORS_ALLOWED_ORIGINS) != "" {
+			result[ARG_CORS_ALLOWED_ORIGINS] = os.Getenv(ARG_CORS_ALLOWED_ORIGINS)
+		} else {
+			result[ARG_CORS_ALLOWED_ORIGINS] = CORS_ALLOWED_ORIGINS
+		}
+		if os.Getenv(ARG_CORS_ALLOWED_METHODS) != "" {
+			result[ARG_CORS_ALLOWED_METHODS] = os.Getenv(ARG_CORS_ALLOWED_METHODS)
+		} else {
+			result[ARG_CORS_ALLOWED_METHODS] = CORS_ALLOWED_METHODS
+		}
+		if os.Getenv(ARG_CORS_ALLOWED_HEADERS) != "" {
+			result[ARG_CORS_ALLOWED_HEADERS] = os.Getenv(ARG_CORS_ALLOWED_HEADERS)
+		} else {
+			result[ARG_CORS_ALLOWED_HEADERS] = CORS_ALLOWED_HEADERS
+		}
+		if os.Getenv(ARG_CORS_MAX_AGE) != "" {
+			result[ARG_CORS_MAX_AGE] = os.Getenv(ARG_CORS_MAX_AGE)
+		} else {
+			result[ARG_CORS_MAX_AGE] = fmt.Sprintf("%d", CORS_MAX_AGE)
+		}
+		if os.Getenv(ARG_CORS_ALLOW_CREDENTIALS) != "" {
+			result[ARG_CORS_ALLOW_CREDENTIALS] = os.Getenv(ARG_CORS_ALLOW_CREDENTIALS)
+		} else {
+			result[ARG_CORS_ALLOW_CREDENTIALS] = fmt.Sprintf("%t", CORS_ALLOW_CREDENTIALS)
+		}
 		if os.Getenv(ARG_WORDS_MARKER_TAG) != "" {
 			result[ARG_WORDS_MARKER_TAG] = os.Getenv(ARG_WORDS_MARKER_TAG)
 		} else {
@@ -363,15 +818,30 @@ func loadDictionary(path string) (Dictionary, error) {
 
 	f, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Не могу получить доступ к файлу '%s'", path)
 		return nil, err
 	}
 	defer f.Close()
-	jsonParser := json.NewDecoder(f)
 
-	var dump Dictionary
-	err = jsonParser.Decode(&dump)
-	return dump, err
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".txt":
+		return parseSolrSynonyms(f)
+	case ".csv":
+		return parseDelimited(f, ',')
+	case ".tsv":
+		return parseDelimited(f, '\t')
+	case ".dic":
+		return parseHunspell(f, strings.TrimSuffix(path, filepath.Ext(path))+".aff")
+	case ".json":
+		jsonParser := json.NewDecoder(f)
+		var dump Dictionary
+		err = jsonParser.Decode(&dump)
+		return dump, err
+	}
+	return nil, SearchError{
+		time.Now(),
+		fmt.Sprintf("Неизвестный формат словаря '%s'", ext),
+	}
 }
 
 func saveSearchLog(constants map[string]string) {
@@ -442,32 +912,28 @@ func transformLettersFilter(tokens []string) []string {
 	return r
 }
 
-func stopWordFilter(tokens []string, stopWords map[string]struct{}) []string {
+func stopWordFilter(tokens []string, stopWords StopWordLists, lang string) []string {
 	r := make([]string, 0, len(tokens))
 	for _, token := range tokens {
-		if _, ok := stopWords[token]; !ok {
+		if !stopWords.contains(token, detectLanguage(token, lang)) {
 			r = append(r, token)
 		}
 	}
 	return r
 }
 
-func stemmerFilter(tokens []string) []string {
+func stemmerFilter(tokens []string, lang string) []string {
 	r := make([]string, len(tokens))
 	for i, token := range tokens {
-		r[i] = getWordStem(token)
+		if isCodeTerm(token) {
+			r[i] = token
+		} else {
+			r[i] = stemWord(token, lang)
+		}
 	}
 	return r
 }
 
-func extractStems(text string, stopWords map[string]struct{}) []string {
-	tokens := tokenize(text)
-	tokens = transformLettersFilter(tokens)
-	tokens = stopWordFilter(tokens, stopWords)
-	tokens = stemmerFilter(tokens)
-	return tokens
-}
-
 func (stemStat StemStat) keys() []string {
 	result := []string{}
 	for k := range stemStat {
@@ -476,19 +942,25 @@ func (stemStat StemStat) keys() []string {
 	return result
 }
 
-func (stemStat StemStat) addToIndex(docs []Document, stopWords map[string]struct{}, constants map[string]string) {
+func (stemStat StemStat) addToIndex(docs []Document, analyzers FieldAnalyzers, positions PositionIndex, fingerprints *Fingerprints, constants map[string]string) {
 	titleWeight, _ := strconv.ParseFloat(constants[ARG_WORDS_TITLE_WEIGHT], 64)
 	keywordWeight, _ := strconv.ParseFloat(constants[ARG_WORDS_KEYWORDS_WEIGHT], 64)
 	for docIndex, doc := range docs {
 		docTokenStat := make(map[string]float64)
 		docTokenCounter := 0
-		for _, content := range doc.Content {
-			tokensInContent := extractStems(content, stopWords)
+		paragraphs := [][]string{}
+		for paragraph, content := range doc.Content {
+			tokensInContent := analyzeLanguage(analyzers[FIELD_CONTENT], content, doc.Lang)
 			docTokenCounter += len(tokensInContent)
-			for _, token := range tokensInContent {
+			paragraphs = append(paragraphs, tokensInContent)
+			for offset, token := range tokensInContent {
 				docTokenStat[token] += 1.0
+				positions.add(token, docIndex, TermPosition{paragraph, offset})
 			}
 		}
+		if fingerprints != nil {
+			fingerprints.add(docIndex, paragraphs)
+		}
 		for token, amount := range docTokenStat {
 			stemStat[token] = append(stemStat[token], DocStat{
 				DocIndex:     docIndex,
@@ -498,12 +970,9 @@ func (stemStat StemStat) addToIndex(docs []Document, stopWords map[string]struct
 			})
 		}
 		if doc.Title != "" {
-			tokens := extractStems(removeSpecialSymbolsFromString(doc.Title), stopWords)
+			tokens := analyzeLanguage(analyzers[FIELD_TITLE], html.UnescapeString(doc.Title), doc.Lang)
 			for _, token := range tokens {
 				newStat := titleWeight * float64(len(token)) / float64(len(strings.Join(tokens, " ")))
-				if doc.Title == "`&lt;a&gt;`" {
-					fmt.Printf("%v - %f", tokens, newStat)
-				}
 				has := false
 				for _, s := range stemStat[token] {
 					if s.DocIndex == docIndex {
@@ -530,7 +999,7 @@ func (stemStat StemStat) addToIndex(docs []Document, stopWords map[string]struct
 		if doc.Keywords != nil {
 			l := len(doc.Keywords)
 			for _, keywordPhrase := range doc.Keywords {
-				for index, token := range extractStems(keywordPhrase, stopWords) {
+				for index, token := range analyzeLanguage(analyzers[FIELD_KEYWORDS], keywordPhrase, doc.Lang) {
 					stemStat[token] = append(stemStat[token], DocStat{
 						DocIndex:     docIndex,
 						DocFrequency: keywordWeight * (float64(index + 1)) / float64(l),
@@ -546,50 +1015,97 @@ func (stemStat StemStat) addToIndex(docs []Document, stopWords map[string]struct
 	}
 }
 
-func (stemStat StemStat) findAndInsertVariations(stem string, termVariations []string, stopWords map[string]struct{}) {
+func (stemStat StemStat) findAndInsertVariations(stem string, termVariations []string, analyzer Analyzer, relations DictionaryRelations) {
 	for _, tv := range termVariations {
 		if !strings.ContainsAny(tv, " ,!?") {
-			newStem := getWordStem(tv)
-			if _, ok := stemStat[newStem]; ok {
-				stemStat[newStem] = append(stemStat[newStem], stemStat[stem]...)
-			} else {
-				stemStat[newStem] = stemStat[stem]
+			for _, newStem := range analyzeTerm(analyzer, tv) {
+				if _, ok := stemStat[newStem]; ok {
+					stemStat[newStem] = append(stemStat[newStem], stemStat[stem]...)
+				} else {
+					stemStat[newStem] = stemStat[stem]
+				}
+				if newStem != stem {
+					relations.IndexedVariants[newStem] = appendUnique(relations.IndexedVariants[newStem], []string{stem})
+				}
 			}
 		}
 	}
 }
 
-func (stemStat StemStat) applyDictionaries(dir string, stopWords map[string]struct{}) {
+// Термины словарей обрабатываются анализатором запросов, чтобы совпадать с основами слов запроса
+func (stemStat StemStat) applyDictionaries(dir string, analyzer Analyzer, constants map[string]string) (DictionaryRelations, error) {
+	relations := newDictionaryRelations()
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		log.Fatal(err)
+		return relations, SearchError{time.Now(), fmt.Sprintf("Не могу прочитать папку словарей '%s': %s", dir, err)}
 	}
 	for _, file := range files {
+		if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) == ".aff" {
+			continue
+		}
 		dic, err := loadDictionary(fmt.Sprintf("%s/%s", dir, file.Name()))
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Словарь '%s' пропущен из-за ошибки: %s", file.Name(), err)
+			continue
 		}
+		relation := dictionaryRelation(file.Name(), dic)
+		oneWay := dictionaryOneWayTerms(dic)
 		counter := 0
-		for dTerm, dVars := range dic {
-			for _, stem := range stemStat.keys() {
-				if !strings.ContainsAny(dTerm, " ,!?") && strings.Contains(dTerm, stem) {
-					stemStat.findAndInsertVariations(stem, dVars, stopWords)
+		switch relation {
+		case RELATION_PARONYM:
+			counter = addRelation(relations.Paronyms, dic, analyzer)
+		case RELATION_ANTONYM:
+			counter = addRelation(relations.Antonyms, dic, analyzer)
+		default:
+			counter = relations.addPhrases(dic, oneWay, analyzer)
+			if constants[ARG_DICTS_EXPANSION_MODE] == DICTS_EXPANSION_QUERY {
+				counter += relations.addExpansions(dic, oneWay, analyzer)
+				break
+			}
+			for dTerm, dVars := range dic {
+				added := false
+				twoWay := []string{}
+				for _, dVar := range dVars {
+					if !isOneWay(dic, oneWay, dTerm, dVar) {
+						twoWay = append(twoWay, dVar)
+						continue
+					}
+					// При замене «a => b» по термину находятся документы с вариантом, но не наоборот
+					for _, stem := range analyzeTerm(analyzer, dVar) {
+						if _, ok := stemStat[stem]; ok {
+							stemStat.findAndInsertVariations(stem, []string{dTerm}, analyzer, relations)
+							added = true
+						}
+					}
+				}
+				if len(twoWay) > 0 {
+					for _, stem := range stemStat.keys() {
+						if !strings.ContainsAny(dTerm, " ,!?") && strings.Contains(dTerm, stem) {
+							stemStat.findAndInsertVariations(stem, twoWay, analyzer, relations)
+							added = true
+							break
+						}
+					}
+				}
+				if added {
 					counter++
-					break
 				}
 			}
 		}
-		log.Printf("%d терминов добавлено из словаря '%s'", counter, file.Name())
+		log.Printf("%d терминов добавлено из словаря '%s' (%s)", counter, file.Name(), relation)
 	}
+	return relations, nil
 }
 
 func editorDistance(token string, stem string) int {
-	s1len := len([]rune(token))
-	s2len := len([]rune(stem))
+	tokenRunes := []rune(token)
+	stemRunes := []rune(stem)
+	s1len := len(tokenRunes)
+	s2len := len(stemRunes)
 	if strings.HasPrefix(stem, token) && float64((s2len-s1len)/s2len) < 0.5 {
 		return 0
 	}
-	column := make([]int, len(token)+1)
+	column := make([]int, s1len+1)
 
 	for y := 1; y <= s1len; y++ {
 		column[y] = y
@@ -600,7 +1116,7 @@ func editorDistance(token string, stem string) int {
 		for y := 1; y <= s1len; y++ {
 			oldkey := column[y]
 			var incr int
-			if token[y-1] != stem[x-1] {
+			if tokenRunes[y-1] != stemRunes[x-1] {
 				incr = 1
 			}
 
@@ -611,34 +1127,47 @@ func editorDistance(token string, stem string) int {
 	return column[s1len]
 }
 
-func changeKeyboardLayout(s string) string {
-	layoutMap := map[string]string{
-		// Latin
-		"q": "й", "w": "ц", "e": "у", "r": "к", "t": "е", "y": "н", "u": "г", "i": "ш", "o": "щ", "p": "з", "[": "х", "]": "ъ",
-		"a": "ф", "s": "ы", "d": "в", "f": "а", "g": "п", "h": "р", "j": "о", "k": "л", "l": "д", ";": "ж", "'": "э", "\\": "ё", "`": "ё",
-		"z": "я", "x": "ч", "c": "с", "v": "м", "b": "и", "n": "т", "m": "ь", ",": "б", ".": "ю",
-		// Cyrillic
-		"й": "q", "ц": "w", "у": "e", "к": "r", "е": "t", "н": "y", "г": "u", "ш": "i", "щ": "o", "з": "p",
-		"ф": "a", "ы": "s", "в": "d", "а": "f", "п": "g", "р": "h", "о": "j", "л": "k", "д": "l",
-		"я": "z", "ч": "x", "с": "c", "м": "v", "и": "b", "т": "n", "ь": "m",
-	}
-	result := ""
-	for _, rune := range strings.Split(s, "") {
-		result += layoutMap[rune]
-	}
-	return result
+type tokenCandidate struct {
+	text   string
+	layout string
 }
 
-func preproccessRequestTokens(tokens []string, stemKeys []string, constants map[string]string) map[int][]string {
+func preproccessRequestTokens(ctx context.Context, tokens []string, stemKeys []string, options SearchOptions, constants map[string]string) map[int][]string {
 	results := make(map[int][]string)
 	limit, _ := strconv.Atoi(constants[ARG_WORDS_DISTANCE_LIMIT])
 	for i, t := range tokens {
+		// Слово сравнивается с основами в индексе как есть, в других раскладках клавиатуры и в транслитерации
+		candidates := []tokenCandidate{{text: t}}
+		seen := map[string]struct{}{t: {}}
+		for _, layout := range options.KeyboardLayouts {
+			if converted := layout.convert(t); converted != t {
+				if _, ok := seen[converted]; !ok {
+					seen[converted] = struct{}{}
+					candidates = append(candidates, tokenCandidate{converted, layout.Name})
+				}
+			}
+		}
+		for _, alternative := range transliterate(t, options.Transliterations) {
+			candidates = append(candidates, tokenCandidate{text: alternative})
+		}
 		closeStems := make(map[int][]string)
-		for _, s := range stemKeys {
-			if l := editorDistance(t, s); l <= limit {
-				closeStems[l] = append(closeStems[l], s)
-			} else if l := editorDistance(changeKeyboardLayout(t), s); l <= limit {
-				closeStems[l] = append(closeStems[l], s)
+		sources := make(map[string]tokenCandidate)
+		for j, s := range stemKeys {
+			if j%1024 == 0 && ctx.Err() != nil {
+				return results
+			}
+			best := limit + 1
+			for _, candidate := range candidates {
+				if l := editorDistance(candidate.text, s); l < best {
+					best = l
+					sources[s] = candidate
+					if l == 0 {
+						break
+					}
+				}
+			}
+			if best <= limit {
+				closeStems[best] = append(closeStems[best], s)
 			}
 		}
 		if len(closeStems[0]) > 0 {
@@ -652,16 +1181,27 @@ func preproccessRequestTokens(tokens []string, stemKeys []string, constants map[
 			}
 			results[i] = append(results[i], closeStems[min]...)
 		}
+		for _, s := range results[i] {
+			if source := sources[s]; source.layout != "" {
+				log.Printf("Исправлена раскладка клавиатуры '%s': '%s' → '%s'", source.layout, t, source.text)
+				break
+			}
+		}
 	}
 	return results
 }
 
-func mergeDocStat(docStats [][]DocStat, category []string, tags []string, constants map[string]string) []int {
-	var result []int = nil
+func mergeDocStat(docStats [][]DocStat, allowed Bitmap, constants map[string]string, scores []float64) []DocStat {
+	var result []DocStat = nil
 	var stats []DocStat = nil
 	for _, docStatForWord := range docStats {
 		stats = append(stats, docStatForWord...)
 	}
+	if scores != nil {
+		for i := range stats {
+			stats[i].DocFrequency *= scores[stats[i].DocIndex]
+		}
+	}
 	sort.Sort(ByFrequency(stats))
 	limit, _ := strconv.ParseFloat(constants[ARG_WORDS_FREQUENCY_LIMIT], 64)
 	minFreqLimit := 0.0
@@ -669,38 +1209,11 @@ func mergeDocStat(docStats [][]DocStat, category []string, tags []string, consta
 		minFreqLimit = stats[0].DocFrequency * limit
 	}
 	for _, s := range stats {
-		if s.DocFrequency < minFreqLimit {
-			continue
-		}
-		if len(category) > 0 && category[0] != "" {
-			for _, category := range category {
-				if category == s.DocCategory {
-					if len(tags) > 0 && tags[0] != "" {
-						for _, tag := range tags {
-							for _, dTag := range s.DocTags {
-								if tag == dTag {
-									result = append(result, s.DocIndex)
-								}
-							}
-						}
-					} else {
-						result = append(result, s.DocIndex)
-					}
-				}
-			}
-		} else if len(tags) > 0 && tags[0] != "" {
-			for _, tag := range tags {
-				for _, dTag := range s.DocTags {
-					if tag == dTag {
-						result = append(result, s.DocIndex)
-					}
-				}
-			}
-		} else {
-			result = append(result, s.DocIndex)
+		if s.DocFrequency >= minFreqLimit && allowed.has(s.DocIndex) {
+			result = append(result, s)
 		}
 	}
-	return removeDuplicates(result)
+	return removeDuplicateStats(result)
 }
 
 func intersectDocStat(first []DocStat, second []DocStat) []DocStat {
@@ -746,124 +1259,197 @@ func subtractDocStat(first []DocStat, second []DocStat) []DocStat {
 	return result
 }
 
-func getDocIndices(
-	words []string,
+// Объединяет статистику для вариантов основы слова
+func (stemStat StemStat) variantsDocStat(variants []string, options SearchOptions) []DocStat {
+	result := []DocStat{}
+	for _, v := range variants {
+		result = append(result, stemStat.expandedDocStat(v, options)...)
+	}
+	return result
+}
+
+// Статистика для основы слова вместе с её вариантами из словарей (с пониженным весом)
+func (stemStat StemStat) expandedDocStat(stem string, options SearchOptions) []DocStat {
+	result := append([]DocStat{}, stemStat[stem]...)
+	for _, expansion := range options.Expansions[stem] {
+		for _, s := range stemStat[expansion] {
+			s.DocFrequency *= options.ExpansionWeight
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func getDocStats(
+	words []PreparedWord,
 	stemStat StemStat,
 	stemKeys []string,
-	stopWords map[string]struct{},
 	constants map[string]string,
-	category []string,
-	tags []string,
-) []int {
+	allowed Bitmap,
+	options SearchOptions,
+) []DocStat {
 	var r [][]DocStat
-	for wordIndex, word := range words {
-		r = append(r, []DocStat{})
-		if strings.Contains(word, "+") {
-			m := []DocStat{}
-			tokens := strings.Split(word, "+")
-			for i, token := range tokens {
-				if i == 0 {
-					m = append(m, stemStat[token]...)
-				} else {
-					m = intersectDocStat(m, stemStat[token])
-				}
-			}
-			r[wordIndex] = append(r[wordIndex], m...)
-		} else if strings.Contains(word, "-") {
-			m := []DocStat{}
-			tokens := strings.Split(word, "-")
-			for i, token := range tokens {
-				if i == 0 {
-					m = append(m, stemStat[token]...)
-				} else {
-					m = subtractDocStat(m, stemStat[token])
-				}
-			}
-			r[wordIndex] = append(r[wordIndex], m...)
-		} else {
-			tokens := extractStems(word, stopWords)
-			for _, token := range tokens {
-				r[wordIndex] = append(r[wordIndex], stemStat[token]...)
+	for _, word := range words {
+		m := []DocStat{}
+		for _, operand := range word {
+			switch operand.Operator {
+			case '+':
+				m = intersectDocStat(m, stemStat.variantsDocStat(operand.Variants, options))
+			case '-':
+				m = subtractDocStat(m, stemStat.variantsDocStat(operand.Variants, options))
+			default:
+				m = append(m, stemStat.variantsDocStat(operand.Variants, options)...)
 			}
 		}
+		r = append(r, m)
 	}
-	result := mergeDocStat(r, category, tags, constants)
+	result := mergeDocStat(r, allowed, constants, options.DocumentScores)
 	return result
 }
 
 func prepareWords(
+	ctx context.Context,
 	words []string,
 	stemKeys []string,
-	stopWords map[string]struct{},
+	analyzer Analyzer,
 	constants map[string]string,
-) []string {
-	preprocessed := []string{}
+	options SearchOptions,
+) ([]PreparedWord, [][]string) {
+	preprocessed := []PreparedWord{}
+	// Варианты каждого слова запроса по порядку — для оценки близости слов в документе
+	proximityGroups := [][]string{}
 	for _, word := range words {
-		variants := preproccessRequestTokens(extractStems(word, stopWords), stemKeys, constants)
-		if strings.Contains(word, "+") {
-			counter := 0
-			buffer := []string{}
-			for l, vars := range variants {
-				varLength := len(vars)
-				bufferLength := len(buffer)
-				if l > 0 {
-					for j := counter - 1; j < bufferLength; j++ {
-						for i := 0; i < varLength; i++ {
-							buffer = append(buffer, buffer[j]+"+"+vars[i])
-						}
-					}
-				} else {
-					buffer = append(buffer, vars...)
+		if (strings.Contains(word, "+") || strings.Contains(word, "-")) && !isIndexedCompound(word, stemKeys, analyzer) {
+			operator := "+"
+			if !strings.Contains(word, "+") {
+				operator = "-"
+			}
+			operands := PreparedWord{}
+			for l, part := range strings.Split(word, operator) {
+				tokens := analyzer.Analyze(part)
+				if len(tokens) == 0 {
+					continue
 				}
-				if l < len(variants)-1 {
-					counter += varLength
+				variants := preproccessRequestTokens(ctx, tokens, stemKeys, options, constants)
+				group := []string{}
+				for i := 0; i < len(tokens); i++ {
+					group = append(group, variants[i]...)
 				}
-			}
-			preprocessed = append(preprocessed, buffer[counter:]...)
-		} else if strings.Contains(word, "-") {
-			counter := 0
-			buffer := []string{}
-			for l, vars := range variants {
-				varLength := len(vars)
-				bufferLength := len(buffer)
-				if l > 0 {
-					for i := 0; i < varLength; i++ {
-						for j := counter - varLength + 1; j < bufferLength; j++ {
-							buffer = append(buffer, buffer[j]+"-"+vars[i])
-						}
+				if len(group) > 0 {
+					// Оператор остаётся при своём операнде: запрос `-grid` только исключает документы
+					operand := QueryOperand{Variants: group}
+					if l > 0 {
+						operand.Operator = operator[0]
 					}
-				} else {
-					buffer = append(buffer, vars...)
+					operands = append(operands, operand)
+					if l == 0 || operator == "+" {
+						proximityGroups = append(proximityGroups, group)
+					}
+				} else if l == 0 || operator == "+" {
+					operands = nil
+					break
 				}
-				counter += varLength
 			}
-			preprocessed = append(preprocessed, buffer[counter:]...)
+			if len(operands) > 0 {
+				preprocessed = append(preprocessed, operands)
+			}
 		} else {
-			for _, v := range variants {
-				preprocessed = append(preprocessed, v...)
+			tokens := analyzer.Analyze(word)
+			variants := preproccessRequestTokens(ctx, tokens, stemKeys, options, constants)
+			for i := 0; i < len(tokens); i++ {
+				for _, variant := range variants[i] {
+					preprocessed = append(preprocessed, PreparedWord{{Variants: []string{variant}}})
+				}
+				if len(variants[i]) > 0 {
+					proximityGroups = append(proximityGroups, variants[i])
+				}
+			}
+		}
+	}
+	return preprocessed, proximityGroups
+}
+
+// Слово с дефисом, которое целиком есть в индексе (например, свойство CSS), ищется как термин, а не как исключение
+func isIndexedCompound(word string, stemKeys []string, analyzer Analyzer) bool {
+	if strings.Contains(word, "+") {
+		return false
+	}
+	for _, token := range analyzer.Analyze(word) {
+		if !strings.Contains(token, "-") {
+			continue
+		}
+		for _, key := range stemKeys {
+			if key == token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Основы подготовленного запроса без исключённых через '-' (нужны для подсветки)
+func preparedStems(preparedWords []PreparedWord) []string {
+	result := []string{}
+	for _, word := range preparedWords {
+		for _, operand := range word {
+			if operand.Operator != '-' {
+				result = append(result, operand.Variants...)
 			}
 		}
 	}
-	return preprocessed
+	return result
 }
 
 func getHits(
-	host string,
+	ctx context.Context,
 	words []string,
 	documents []Document,
 	stemStat StemStat,
 	stemKeys []string,
-	stopWords map[string]struct{},
+	analyzer Analyzer,
 	constants map[string]string,
 	category []string,
 	tags []string,
-) []Hit {
-	defer timeTrackSearch(time.Now(), strings.Join(words, " "), host, category, tags, constants)
+	options SearchOptions,
+) ([]Hit, error) {
+	analyzer = withLanguage(analyzer, options.Language)
+	allowed := options.Attributes.allowed(options.Filter, category, tags)
+	if strings.TrimSpace(strings.Join(words, "")) == "" {
+		hits, found := listDocuments(documents, allowed)
+		order := sortOrder(found, documents, options.Sort)
+		if constants[ARG_DUPLICATES_COLLAPSE] == "true" {
+			order = options.Duplicates.collapse(found, order)
+		}
+		return reorderHits(hits, order), nil
+	}
 	var resultWithFragments []Hit
-	preparedWords := prepareWords(words, stemKeys, stopWords, constants)
-	for _, index := range getDocIndices(preparedWords, stemStat, stemKeys, stopWords, constants, category, tags) {
-		_, title := markWord(words, stopWords, documents[index].Title, constants, false)
-		fragments := prepareFragments(words, stopWords, documents, index, constants)
+	preparedWords, proximityGroups := prepareWords(ctx, words, stemKeys, analyzer, constants, options)
+	options.DocumentScores = proximityScores(proximityGroups, options.Positions, options.DocumentScores, len(documents), constants)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// Подсвечиваются и найденные в индексе основы: с учётом ошибок, раскладки и транслитерации
+	markedWords := append(append([]string{}, words...), preparedStems(preparedWords)...)
+	markedWords = append(markedWords, expansionStems(preparedWords, options.Expansions)...)
+	markedWords = append(markedWords, expansionStems(preparedWords, options.IndexedVariants)...)
+	excluded := make(map[int]struct{})
+	for _, stem := range options.ExcludedStems {
+		for _, s := range stemStat[stem] {
+			excluded[s.DocIndex] = struct{}{}
+		}
+	}
+	// Частотности найденных документов в порядке хитов — для разнообразия выдачи
+	var found []DocStat
+	for _, stat := range getDocStats(preparedWords, stemStat, stemKeys, constants, allowed, options) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		index := stat.DocIndex
+		if _, ok := excluded[index]; ok {
+			continue
+		}
+		_, title := markWord(markedWords, analyzer, documents[index].Title, constants, false)
+		fragments := prepareFragments(markedWords, analyzer, documents, index, constants)
 		if len(fragments) > 0 {
 			resultWithFragments = append(resultWithFragments, Hit{
 				Title:     title,
@@ -872,14 +1458,24 @@ func getHits(
 				Tags:      documents[index].Tags,
 				Category:  documents[index].Category,
 			})
+			found = append(found, stat)
 		}
 	}
-	return resultWithFragments
+	var order []int
+	if len(options.Sort) > 0 {
+		order = sortOrder(found, documents, options.Sort)
+	} else {
+		order = diversify(found, constants)
+	}
+	if constants[ARG_DUPLICATES_COLLAPSE] == "true" {
+		order = options.Duplicates.collapse(found, order)
+	}
+	return reorderHits(resultWithFragments, order), nil
 }
 
 func markWord(
 	words []string,
-	stopWords map[string]struct{},
+	analyzer Analyzer,
 	s string,
 	constants map[string]string,
 	trim bool,
@@ -893,14 +1489,22 @@ func markWord(
 	for _, w := range words {
 		w = strings.ReplaceAll(w, "ё", "е")
 		if strings.Contains(w, "+") {
-			searchWords = append(searchWords, strings.ReplaceAll(w, "+", fmt.Sprintf(".{0,%s}", distance)))
+			parts := strings.Split(w, "+")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			searchWords = append(searchWords, strings.Join(parts, fmt.Sprintf(".{0,%s}", distance)))
 		} else if strings.Contains(w, "-") {
-			searchWords = append(searchWords, strings.Split(w, "-")...)
+			searchWords = append(searchWords, quoteTerms(append([]string{w}, strings.Split(w, "-")...))...)
 		} else {
-			searchWords = append(searchWords, w)
+			searchWords = append(searchWords, quoteTerms([]string{w})...)
 		}
-		searchWords = append(searchWords, extractStems(w, stopWords)...)
+		searchWords = append(searchWords, quoteTerms(analyzer.Analyze(w))...)
 	}
+	// Длинные термины проверяются первыми, чтобы `grid-template-columns` выделялось целиком
+	sort.SliceStable(searchWords, func(i, j int) bool {
+		return len(searchWords[i]) > len(searchWords[j])
+	})
 	re := regexp.MustCompile("(" + strings.ToLower(strings.Join(searchWords, "|")) + ")")
 	occurrences := re.FindAllIndex([]byte(lowerCase), occurencesStart)
 	oLength := len(occurrences)
@@ -947,10 +1551,25 @@ func markWord(
 	return false, s
 }
 
-func prepareFragments(words []string, stopWords map[string]struct{}, documents []Document, docNumber int, constants map[string]string) []string {
+// Экранирует термины для регулярного выражения; теги ищутся и в экранированном виде `&lt;a&gt;`
+func quoteTerms(terms []string) []string {
+	result := []string{}
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		result = append(result, regexp.QuoteMeta(term))
+		if escaped := html.EscapeString(term); escaped != term {
+			result = append(result, regexp.QuoteMeta(escaped))
+		}
+	}
+	return result
+}
+
+func prepareFragments(words []string, analyzer Analyzer, documents []Document, docNumber int, constants map[string]string) []string {
 	var fragments []string
 	for _, p := range documents[docNumber].Content {
-		contains, marked := markWord(words, stopWords, p, constants, true)
+		contains, marked := markWord(words, analyzer, p, constants, true)
 		if contains {
 			fragments = append(fragments, marked)
 		}
@@ -987,47 +1606,281 @@ func prepareSearchRequest(searchRequest string) string {
 	return result
 }
 
+// Параметры поискового запроса после применения правил выдачи и расширения фразы по словарям
+type SearchQuery struct {
+	Phrase   string
+	Category []string
+	Tags     []string
+	Options  SearchOptions
+	Rules    *RuleSet
+	Applied  AppliedRules
+}
+
+// Слова поисковой фразы без операторов: части слов через '+' и '-' считаются отдельными словами
+func queryTerms(searchRequest string) []string {
+	return strings.FieldsFunc(searchRequest, func(r rune) bool {
+		return r == ' ' || r == '+' || r == '-'
+	})
+}
+
+// Разбирает параметры запроса; пустая фраза допускается, если нужна выдача без поисковой фразы
+func parseSearchQuery(r *http.Request, index *SearchIndex, constants map[string]string, allowEmpty bool) (SearchQuery, error) {
+	searchTags := []string{}
+	searchCategory := []string{}
+	if r.URL.Query()["tags"] != nil {
+		searchTags = r.URL.Query()["tags"]
+	}
+	if r.URL.Query()["category"] != nil {
+		searchCategory = r.URL.Query()["category"]
+	}
+	sortKeys, err := parseSortKeys(r.URL.Query().Get("sort"), index.Attributes)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	maxLength, _ := strconv.Atoi(constants[ARG_APP_QUERY_MAX_LENGTH])
+	if utf8.RuneCountInString(r.URL.Query().Get("filter")) > maxLength {
+		return SearchQuery{}, SearchError{time.Now(), fmt.Sprintf("Выражение фильтра не может быть длиннее %d символов", maxLength)}
+	}
+	filter, err := parseFilter(r.URL.Query().Get("filter"), index.Attributes)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	// Без поисковой фразы выдаются все документы раздела, если задан порядок сортировки
+	isListing := len(sortKeys) > 0 && (filter != nil || len(removeValues(append(searchTags, searchCategory...), []string{""})) > 0)
+	if strings.TrimSpace(r.URL.Query().Get("search")) == "" && !isListing && !allowEmpty {
+		return SearchQuery{}, SearchError{time.Now(), "Поисковая фраза не может быть пустой"}
+	}
+	searchRequest := prepareSearchRequest(r.URL.Query().Get("search"))
+	if utf8.RuneCountInString(searchRequest) > maxLength {
+		return SearchQuery{}, SearchError{time.Now(), fmt.Sprintf("Поисковая фраза не может быть длиннее %d символов", maxLength)}
+	}
+	maxTerms, _ := strconv.Atoi(constants[ARG_APP_QUERY_MAX_TERMS])
+	if len(queryTerms(searchRequest)) > maxTerms {
+		return SearchQuery{}, SearchError{time.Now(), fmt.Sprintf("Поисковая фраза не может содержать больше %d слов", maxTerms)}
+	}
+	rules := getRules()
+	applied := rules.apply(searchRequest, index.QueryAnalyzer)
+	if len(applied.Ids) > 0 {
+		log.Printf("К фразе '%s' применены правила: %s", searchRequest, strings.Join(applied.Ids, ", "))
+		searchRequest = prepareSearchRequest(applied.Query)
+		searchCategory = appendUnique(removeValues(searchCategory, []string{""}), applied.Category)
+		searchTags = appendUnique(removeValues(searchTags, []string{""}), applied.Tags)
+	}
+	searchRequest = index.Relations.expandPhrases(searchRequest, index.QueryAnalyzer)
+	now, date := recencyDate(time.Now(), constants)
+	options := SearchOptions{
+		Expansions:       index.Relations.Expansions,
+		IndexedVariants:  index.Relations.IndexedVariants,
+		Transliterations: index.Transliterations,
+		KeyboardLayouts:  index.KeyboardLayouts,
+		DocumentScores:   documentScores(index.Ranking, now, constants),
+		RecencyDate:      date,
+		Positions:        index.Positions,
+		Sort:             sortKeys,
+		Attributes:       index.Attributes,
+		Filter:           filter,
+		Duplicates:       index.Duplicates,
+	}
+	options.ExpansionWeight, _ = strconv.ParseFloat(constants[ARG_DICTS_EXPANSION_WEIGHT], 64)
+	options.Language = normalizeLanguage(r.URL.Query().Get("lang"))
+	if r.URL.Query().Get("antonyms") == "exclude" {
+		options.ExcludedStems = index.Relations.antonymStems(searchRequest, index.QueryAnalyzer)
+	}
+	return SearchQuery{
+		Phrase:   searchRequest,
+		Category: searchCategory,
+		Tags:     searchTags,
+		Options:  options,
+		Rules:    rules,
+		Applied:  applied,
+	}, nil
+}
+
+func (query SearchQuery) cacheKey() string {
+	return cacheKey(query.Phrase, query.Category, query.Tags, query.Options)
+}
+
+// Хиты из кэша или результат нового поиска, ограниченного по времени.
+// В лог поисковых запросов пишут обработчики, которые отвечают пользователям
+func cachedHits(r *http.Request, index *SearchIndex, query SearchQuery, cache *ResultCache, constants map[string]string) ([]Hit, error) {
+	key := query.cacheKey()
+	hits, ok := cache.get(key, index.Generation)
+	if ok {
+		return hits, nil
+	}
+	timeout, _ := strconv.Atoi(constants[ARG_APP_SEARCH_TIMEOUT])
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+	hits, err := getHits(ctx, strings.Split(query.Phrase, " "), index.Documents, index.Stems, index.StemKeys, index.QueryAnalyzer, constants, query.Category, query.Tags, query.Options)
+	if err != nil {
+		return nil, err
+	}
+	cache.put(key, index.Generation, hits)
+	return hits, nil
+}
+
 func callbackHandler(
-	documents []Document,
-	stemStat StemStat,
-	stemKeys []string,
-	stopWords map[string]struct{},
+	cache *ResultCache,
 	constants map[string]string,
 ) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		searchTags := []string{}
-		searchCategory := []string{}
-		searchRequest := prepareSearchRequest(r.URL.Query()["search"][0])
-		if r.URL.Query()["tags"] != nil {
-			searchTags = r.URL.Query()["tags"]
+		index := getIndex()
+		query, err := parseSearchQuery(r, index, constants, false)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.(SearchError).What)
+			return
 		}
-		if r.URL.Query()["category"] != nil {
-			searchCategory = r.URL.Query()["category"]
+		encoding := negotiateEncoding(w, r)
+		etag := computeETag(index.Id, query.cacheKey()+"\x1e"+query.Rules.Id, encoding)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%s", constants[ARG_APP_CACHE_MAX_AGE]))
+		if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchesETag(ifNoneMatch, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
-		hits := getHits(r.RemoteAddr, strings.Split(searchRequest, " "), documents, stemStat, stemKeys, stopWords, constants, searchCategory, searchTags)
+		start := time.Now()
+		hits, err := cachedHits(r, index, query, cache, constants)
+		timeTrackSearch(start, query.Phrase, requestClientIp(r), query.Category, query.Tags, constants)
+		if err != nil {
+			w.Header().Del("ETag")
+			w.Header().Del("Cache-Control")
+			writeError(w, http.StatusServiceUnavailable, "Поиск занял слишком много времени, уточните запрос")
+			return
+		}
+		hits = query.Applied.arrange(hits, index.Documents)
 		bf := bytes.NewBuffer([]byte{})
 		jsonEncoder := json.NewEncoder(bf)
 		jsonEncoder.SetEscapeHTML(false)
 		jsonEncoder.Encode(hits)
-		if origin := r.Header.Get("Origin"); origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Content-Type", "application/json")
+		writeCompressed(w, encoding, bf.Bytes())
+	}
+}
+
+func suggestHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index := getIndex()
+		encoding := negotiateEncoding(w, r)
+		searchRequest := prepareSearchRequest(r.URL.Query().Get("search"))
+		bf := bytes.NewBuffer([]byte{})
+		jsonEncoder := json.NewEncoder(bf)
+		jsonEncoder.SetEscapeHTML(false)
+		jsonEncoder.Encode(map[string][]string{
+			"suggestions": index.Relations.suggestions(searchRequest, index.Stems, index.QueryAnalyzer),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		writeCompressed(w, encoding, bf.Bytes())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func statusHandler(cache *ResultCache) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index := getIndex()
+		status := map[string]interface{}{
+			"generation": index.Generation,
+			"id":         index.Id,
+			"documents":  len(index.Documents),
+			"stems":      len(index.StemKeys),
+			"cache":      cache.stats(),
+			"duplicates": index.Duplicates,
 		}
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Access-Control-Allow-Headers, Accept-Encoding, Authorization, Content-Length, Content-Type, X-CSRF-Token, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Content-Type", "application/json")
-		w.Write(bf.Bytes())
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+func handleSignals(constants map[string]string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Printf("Получен сигнал SIGHUP, перезагружаю словари из папки '%s'", constants[ARG_DICTS_DIR])
+		adminLock.Lock()
+		reloaded, err := reloadDictionaries(getIndex(), constants)
+		if err == nil {
+			setIndex(reloaded)
+		}
+		adminLock.Unlock()
+		if err != nil {
+			log.Printf("Словари не перезагружены, используется прежний поисковый индекс: %s", err.(SearchError).What)
+		} else {
+			log.Printf("Словари перезагружены, поколение поискового индекса: %d", getIndex().Generation)
+		}
+		if rules, err := loadRules(constants[ARG_RULES_FILE]); err != nil {
+			log.Printf("Не могу перезагрузить правила из файла '%s': %s", constants[ARG_RULES_FILE], err)
+		} else {
+			setRules(rules)
+		}
 	}
 }
 
 func main() {
-	stems := make(StemStat)
 	args := loadSettings()
+	if len(os.Args) > 1 && os.Args[1] == "suggest-stop-words" {
+		suggestStopWords(args)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		evaluate(args)
+		return
+	}
 	docs, _ := loadDocuments(args[ARG_SEARCH_CONTENT])
 	stopWords, _ := loadStopWords(args[ARG_STOP_WORDS])
-	stems.addToIndex(docs, stopWords, args)
-	stems.applyDictionaries(args[ARG_DICTS_DIR], stopWords)
+	switch args[ARG_RANKING_POPULARITY_FUNCTION] {
+	case RANKING_POPULARITY_NONE, RANKING_POPULARITY_LINEAR, RANKING_POPULARITY_LOG:
+	default:
+		log.Fatalf("Неизвестная функция популярности '%s', ожидается одно из значений: none, linear, log", args[ARG_RANKING_POPULARITY_FUNCTION])
+	}
+	switch args[ARG_DIVERSIFY_MODE] {
+	case DIVERSIFY_NONE, DIVERSIFY_ROUND_ROBIN, DIVERSIFY_MMR:
+	default:
+		log.Fatalf("Неизвестный способ разнообразия выдачи '%s', ожидается одно из значений: none, round-robin, mmr", args[ARG_DIVERSIFY_MODE])
+	}
+	if distance, _ := strconv.Atoi(args[ARG_DUPLICATES_DISTANCE]); distance > DUPLICATES_MAX_DISTANCE {
+		log.Fatalf("Слишком большое расстояние между отпечатками '%s', ожидается не больше %d", args[ARG_DUPLICATES_DISTANCE], DUPLICATES_MAX_DISTANCE)
+	}
+	rules, err := loadRules(args[ARG_RULES_FILE])
+	if err != nil {
+		log.Fatalf("Не могу загрузить правила из файла '%s': %s", args[ARG_RULES_FILE], err)
+	}
+	setRules(rules)
+	index, err := buildIndex(docs, stopWords, args)
+	if err != nil {
+		log.Fatal(err.(SearchError).What)
+	}
+	setIndex(index)
+	go handleSignals(args)
+	cacheSize, _ := strconv.Atoi(args[ARG_APP_CACHE_SIZE])
+	cache := newResultCache(cacheSize)
 	log.Printf("Формирование поискового индекса завершено. Жду запросов...")
-	http.HandleFunc("/", callbackHandler(docs, stems, stems.keys(), stopWords, args))
-	log.Fatal(http.ListenAndServe(args[ARG_APP_HOST]+":"+args[ARG_APP_PORT], nil))
+	rateLimit, _ := strconv.ParseFloat(args[ARG_APP_RATE_LIMIT], 64)
+	rateBurst, _ := strconv.Atoi(args[ARG_APP_RATE_BURST])
+	limiter := newRateLimiter(rateLimit, rateBurst)
+	proxies := parseTrustedProxies(args[ARG_APP_TRUSTED_PROXIES])
+	http.HandleFunc("/status", statusHandler(cache))
+	http.HandleFunc("/admin/stop-words", adminMiddleware(args[ARG_APP_ADMIN_TOKEN], stopWordsHandler(args)))
+	http.HandleFunc("/admin/dictionaries", adminMiddleware(args[ARG_APP_ADMIN_TOKEN], dictionariesHandler(args)))
+	http.HandleFunc("/admin/dictionaries/", adminMiddleware(args[ARG_APP_ADMIN_TOKEN], dictionaryHandler(args)))
+	http.HandleFunc("/admin/rules", adminMiddleware(args[ARG_APP_ADMIN_TOKEN], rulesHandler(args)))
+	corsPolicy := loadCorsPolicy(args)
+	http.HandleFunc("/related/", corsMiddleware(corsPolicy, rateLimitMiddleware(limiter, proxies, relatedHandler(cache, args))))
+	http.HandleFunc("/facets", corsMiddleware(corsPolicy, rateLimitMiddleware(limiter, proxies, facetsHandler(cache, args))))
+	http.HandleFunc("/suggest", corsMiddleware(corsPolicy, rateLimitMiddleware(limiter, proxies, suggestHandler())))
+	http.HandleFunc("/", corsMiddleware(corsPolicy, rateLimitMiddleware(limiter, proxies, callbackHandler(cache, args))))
+	readTimeout, _ := strconv.Atoi(args[ARG_APP_READ_TIMEOUT])
+	writeTimeout, _ := strconv.Atoi(args[ARG_APP_WRITE_TIMEOUT])
+	idleTimeout, _ := strconv.Atoi(args[ARG_APP_IDLE_TIMEOUT])
+	server := &http.Server{
+		Addr:              args[ARG_APP_HOST] + ":" + args[ARG_APP_PORT],
+		ReadTimeout:       time.Duration(readTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(readTimeout) * time.Second,
+		WriteTimeout:      time.Duration(writeTimeout) * time.Second,
+		IdleTimeout:       time.Duration(idleTimeout) * time.Second,
+	}
+	log.Fatal(server.ListenAndServe())
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Позиция термина в содержимом документа: номер абзаца и номер термина в абзаце
+type TermPosition struct {
+	Paragraph int
+	Offset    int
+}
+
+// Позиции терминов: основа → номер документа → позиции
+type PositionIndex map[string]map[int][]TermPosition
+
+func (positions PositionIndex) add(stem string, docIndex int, position TermPosition) {
+	if _, ok := positions[stem]; !ok {
+		positions[stem] = make(map[int][]TermPosition)
+	}
+	positions[stem][docIndex] = append(positions[stem][docIndex], position)
+}
+
+type groupOccurrence struct {
+	TermPosition
+	group int
+}
+
+// Близость соседних слов запроса в документе от 0 до 1: слова рядом в одном абзаце дают 1,
+// дальше окна — меньше, в обратном порядке — вдвое меньше
+func proximity(occurrences []groupOccurrence, groups int, window int) float64 {
+	sort.Slice(occurrences, func(i, j int) bool {
+		if occurrences[i].Paragraph != occurrences[j].Paragraph {
+			return occurrences[i].Paragraph < occurrences[j].Paragraph
+		}
+		return occurrences[i].Offset < occurrences[j].Offset
+	})
+	closeness := func(distance int) float64 {
+		if distance <= window {
+			return 1
+		}
+		return float64(window) / float64(distance)
+	}
+	best := make([]float64, groups-1)
+	last := make(map[int]TermPosition)
+	paragraph := -1
+	for _, o := range occurrences {
+		if o.Paragraph != paragraph {
+			last = make(map[int]TermPosition)
+			paragraph = o.Paragraph
+		}
+		if previous, ok := last[o.group-1]; ok && o.group > 0 {
+			if score := closeness(o.Offset - previous.Offset); score > best[o.group-1] {
+				best[o.group-1] = score
+			}
+		}
+		if next, ok := last[o.group+1]; ok && o.group+1 < groups {
+			if score := closeness(o.Offset-next.Offset) / 2; score > best[o.group] {
+				best[o.group] = score
+			}
+		}
+		last[o.group] = o.TermPosition
+	}
+	sum := 0.0
+	for _, score := range best {
+		sum += score
+	}
+	return sum / float64(len(best))
+}
+
+// Умножает частотность документов, в которых слова запроса стоят рядом, на 1 + вес × близость
+func proximityScores(groups [][]string, positions PositionIndex, scores []float64, documentsCount int, constants map[string]string) []float64 {
+	if len(groups) < 2 {
+		return scores
+	}
+	weight, _ := strconv.ParseFloat(constants[ARG_PROXIMITY_WEIGHT], 64)
+	window, _ := strconv.Atoi(constants[ARG_PROXIMITY_WINDOW])
+	if weight <= 0 {
+		return scores
+	}
+	occurrences := make(map[int][]groupOccurrence)
+	for group, stems := range groups {
+		seen := make(map[string]struct{})
+		for _, stem := range stems {
+			if _, ok := seen[stem]; ok {
+				continue
+			}
+			seen[stem] = struct{}{}
+			for docIndex, docPositions := range positions[stem] {
+				for _, position := range docPositions {
+					occurrences[docIndex] = append(occurrences[docIndex], groupOccurrence{position, group})
+				}
+			}
+		}
+	}
+	result := make([]float64, documentsCount)
+	for i := range result {
+		result[i] = 1
+		if scores != nil {
+			result[i] = scores[i]
+		}
+	}
+	for docIndex, docOccurrences := range occurrences {
+		result[docIndex] *= 1 + weight*proximity(docOccurrences, len(groups), window)
+	}
+	return result
+}
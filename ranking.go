@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const RANKING_POPULARITY_NONE string = "none"
+const RANKING_POPULARITY_LINEAR string = "linear"
+const RANKING_POPULARITY_LOG string = "log"
+
+// Сигналы ранжирования документа, не зависящие от поисковой фразы
+type RankingSignals struct {
+	Boost      float64
+	Popularity float64
+	UpdatedAt  time.Time
+}
+
+func parseUpdatedAt(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// Популярность приводится к отрезку [0, 1] относительно самого популярного документа
+func newRankingSignals(docs []Document, constants map[string]string) []RankingSignals {
+	function := constants[ARG_RANKING_POPULARITY_FUNCTION]
+	normalize := func(popularity float64) float64 {
+		if function == RANKING_POPULARITY_LOG {
+			return math.Log1p(popularity)
+		}
+		return popularity
+	}
+	maxPopularity := 0.0
+	for _, doc := range docs {
+		maxPopularity = math.Max(maxPopularity, normalize(math.Max(doc.Popularity, 0)))
+	}
+	signals := make([]RankingSignals, len(docs))
+	for i, doc := range docs {
+		signals[i].Boost = 1.0
+		if doc.Boost > 0 {
+			signals[i].Boost = doc.Boost
+		}
+		if maxPopularity > 0 && function != RANKING_POPULARITY_NONE {
+			signals[i].Popularity = normalize(math.Max(doc.Popularity, 0)) / maxPopularity
+		}
+		if doc.UpdatedAt != "" {
+			updatedAt, err := parseUpdatedAt(doc.UpdatedAt)
+			if err != nil {
+				log.Printf("Не могу разобрать дату обновления '%s' документа '%s'", doc.UpdatedAt, doc.ObjectId)
+			} else {
+				signals[i].UpdatedAt = updatedAt
+			}
+		}
+	}
+	return signals
+}
+
+// Понижение по давности считается на начало текущих суток UTC, чтобы выдача в течение суток не менялась:
+// дата входит в ключ кэша и ETag, и на следующий день результаты пересчитываются. Без понижения дата не нужна
+func recencyDate(now time.Time, constants map[string]string) (time.Time, string) {
+	halfLife, _ := strconv.ParseFloat(constants[ARG_RANKING_RECENCY_HALF_LIFE], 64)
+	recencyWeight, _ := strconv.ParseFloat(constants[ARG_RANKING_RECENCY_WEIGHT], 64)
+	if halfLife <= 0 || recencyWeight == 0 {
+		return now, ""
+	}
+	day := now.UTC().Truncate(24 * time.Hour)
+	return day, day.Format("2006-01-02")
+}
+
+// Множитель частотности для каждого документа: boost × (1 + вес × популярность) × затухание по давности обновления.
+// Документы без даты обновления не понижаются
+func documentScores(signals []RankingSignals, now time.Time, constants map[string]string) []float64 {
+	popularityWeight, _ := strconv.ParseFloat(constants[ARG_RANKING_POPULARITY_WEIGHT], 64)
+	halfLife, _ := strconv.ParseFloat(constants[ARG_RANKING_RECENCY_HALF_LIFE], 64)
+	recencyWeight, _ := strconv.ParseFloat(constants[ARG_RANKING_RECENCY_WEIGHT], 64)
+	scores := make([]float64, len(signals))
+	for i, s := range signals {
+		score := s.Boost * (1 + popularityWeight*s.Popularity)
+		if !s.UpdatedAt.IsZero() && halfLife > 0 {
+			age := math.Max(now.Sub(s.UpdatedAt).Hours()/24, 0)
+			score *= 1 - recencyWeight + recencyWeight*math.Pow(0.5, age/halfLife)
+		}
+		scores[i] = score
+	}
+	return scores
+}
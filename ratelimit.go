@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contextKey string
+
+const clientIpKey contextKey = "clientIp"
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Ограничитель частоты запросов по алгоритму «ведро с токенами» для каждого клиента
+type RateLimiter struct {
+	lock        sync.Mutex
+	rate        float64
+	burst       float64
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+type TrustedProxies []*net.IPNet
+
+func newRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:        rate,
+		burst:       math.Max(float64(burst), 1),
+		buckets:     make(map[string]*tokenBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+func (limiter *RateLimiter) allow(key string) bool {
+	if limiter.rate <= 0 {
+		return true
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	now := time.Now()
+	limiter.cleanup(now)
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, updated: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(limiter.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*limiter.rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Удаляет вёдра клиентов, которые успели полностью восстановиться (вызывается под блокировкой)
+func (limiter *RateLimiter) cleanup(now time.Time) {
+	if now.Sub(limiter.lastCleanup) < time.Minute {
+		return
+	}
+	refill := time.Duration(limiter.burst / limiter.rate * float64(time.Second))
+	for key, bucket := range limiter.buckets {
+		if now.Sub(bucket.updated) > refill {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastCleanup = now
+}
+
+func parseTrustedProxies(value string) TrustedProxies {
+	proxies := TrustedProxies{}
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+func (proxies TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Адрес клиента определяется по заголовку X-Forwarded-For, только если запрос пришёл от доверенного прокси
+func (proxies TrustedProxies) clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !proxies.contains(ip) {
+		return host
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(forwarded[i])
+		parsed := net.ParseIP(candidate)
+		if parsed == nil {
+			break
+		}
+		host = candidate
+		if !proxies.contains(parsed) {
+			break
+		}
+	}
+	return host
+}
+
+func requestClientIp(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIpKey).(string); ok {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+func rateLimitMiddleware(limiter *RateLimiter, proxies TrustedProxies, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := proxies.clientIp(r)
+		if !limiter.allow(ip) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Слишком много запросов, повторите попытку позже")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), clientIpKey, ip)))
+	}
+}
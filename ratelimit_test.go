@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, 192.168.1.1, ::1, not-an-ip")
+	if len(proxies) != 3 {
+		t.Fatalf("parseTrustedProxies returned %d networks, want 3", len(proxies))
+	}
+	for _, network := range []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"} {
+		found := false
+		for _, proxy := range proxies {
+			if proxy.String() == network {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("parseTrustedProxies does not contain %s", network)
+		}
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8")
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5"},
+		{"203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"10.0.0.1:1234", "198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"10.0.0.1:1234", "1.1.1.1, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"10.0.0.1:1234", "garbage, 198.51.100.7", "198.51.100.7"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "10.0.0.3", "10.0.0.3"},
+		{"[::1]:1234", "198.51.100.7", "::1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := proxies.clientIp(r); got != test.want {
+			t.Errorf("clientIp(%q, %q) = %q, want %q", test.remoteAddr, test.forwarded, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := newRateLimiter(1, 2)
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.allow("a"); got != want {
+			t.Errorf("allow #%d = %t, want %t", i+1, got, want)
+		}
+	}
+	if !limiter.allow("b") {
+		t.Errorf("allow for another client = false, want true")
+	}
+	if unlimited := newRateLimiter(0, 1); !unlimited.allow("a") || !unlimited.allow("a") {
+		t.Errorf("limiter with zero rate rejects requests")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Основа слова документа с весом tf-idf
+type weightedStem struct {
+	stem   string
+	weight float64
+}
+
+// Самые характерные основы каждого документа: частотность основы в документе с учётом заголовка и ключевых слов,
+// умноженная на обратную документную частоту. Основы, которые есть только в одном документе, не помогают найти похожие
+func distinctiveStems(stemStat StemStat, documentsCount int, limit int) [][]weightedStem {
+	result := make([][]weightedStem, documentsCount)
+	for stem, stats := range stemStat {
+		frequencies := make(map[int]float64)
+		for _, s := range stats {
+			frequencies[s.DocIndex] = math.Max(frequencies[s.DocIndex], s.DocFrequency)
+		}
+		if len(frequencies) < 2 {
+			continue
+		}
+		idf := math.Log(float64(documentsCount) / float64(len(frequencies)))
+		for docIndex, frequency := range frequencies {
+			if frequency > 0 && docIndex < documentsCount {
+				result[docIndex] = append(result[docIndex], weightedStem{stem, frequency * idf})
+			}
+		}
+	}
+	for docIndex, stems := range result {
+		sort.Slice(stems, func(i, j int) bool {
+			if stems[i].weight != stems[j].weight {
+				return stems[i].weight > stems[j].weight
+			}
+			return stems[i].stem < stems[j].stem
+		})
+		if len(stems) > limit {
+			result[docIndex] = stems[:limit]
+		}
+	}
+	return result
+}
+
+// Поисковые фразы для похожих документов — самые характерные основы каждого документа.
+// Считаются один раз при построении индекса; основы, с которыми фраза превысила бы APP_QUERY_MAX_TERMS слов, пропускаются
+func relatedPhrases(stemStat StemStat, documentsCount int, constants map[string]string) []string {
+	termsLimit, _ := strconv.Atoi(constants[ARG_RELATED_TERMS])
+	maxTerms, _ := strconv.Atoi(constants[ARG_APP_QUERY_MAX_TERMS])
+	phrases := make([]string, documentsCount)
+	for docIndex, distinctive := range distinctiveStems(stemStat, documentsCount, termsLimit) {
+		stems := []string{}
+		count := 0
+		for _, stem := range distinctive {
+			if terms := len(queryTerms(stem.stem)); count+terms <= maxTerms {
+				stems = append(stems, stem.stem)
+				count += terms
+			}
+		}
+		phrases[docIndex] = strings.Join(stems, " ")
+	}
+	return phrases
+}
+
+func findDocument(documents []Document, objectId string) (int, bool) {
+	for i, doc := range documents {
+		if doc.ObjectId == objectId {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Похожие документы: `GET /related/{objectID}`, параметр `same=category,tags` ограничивает выдачу
+// документами той же категории и с общими тегами. Характерные основы документа ищутся так же, как фраза в `/`:
+// с ранжированием, близостью слов, правилами выдачи и схлопыванием дубликатов
+func relatedHandler(cache *ResultCache, constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index := getIndex()
+		objectId := strings.Trim(strings.TrimPrefix(r.URL.Path, "/related/"), "/")
+		docIndex, ok := findDocument(index.Documents, objectId)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Документ '%s' не найден", objectId))
+			return
+		}
+		doc := index.Documents[docIndex]
+		var category, tags []string
+		same := []string{}
+		for _, value := range r.URL.Query()["same"] {
+			same = append(same, strings.Split(value, ",")...)
+		}
+		for _, field := range same {
+			switch strings.TrimSpace(field) {
+			case "category":
+				category = []string{doc.Category}
+			case "tags":
+				tags = append([]string{}, doc.Tags...)
+			case "":
+			default:
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Неизвестное значение '%s' параметра same, ожидается category или tags", field))
+				return
+			}
+		}
+		// ETag зависит только от поколения индекса, правил и даты понижения по давности, поэтому проверяется до разбора фразы
+		rules := getRules()
+		_, date := recencyDate(time.Now(), constants)
+		encoding := negotiateEncoding(w, r)
+		etag := computeETag(index.Id, fmt.Sprintf("related\x1e%s\x1e%v\x1e%v\x1e%s\x1e%s", objectId, category, tags, rules.Id, date), encoding)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%s", constants[ARG_APP_CACHE_MAX_AGE]))
+		if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchesETag(ifNoneMatch, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		phrase := index.RelatedPhrases[docIndex]
+		// У документа без тегов нет документов с общими тегами
+		found := phrase != "" && (tags == nil || len(tags) > 0)
+		query := SearchQuery{Rules: rules}
+		if found {
+			search := r.Clone(r.Context())
+			search.URL.RawQuery = url.Values{"search": {phrase}, "category": category, "tags": tags}.Encode()
+			var err error
+			if query, err = parseSearchQuery(search, index, constants, false); err != nil {
+				w.Header().Del("ETag")
+				w.Header().Del("Cache-Control")
+				writeError(w, http.StatusBadRequest, err.(SearchError).What)
+				return
+			}
+			query.Applied.Hide[objectId] = struct{}{}
+		}
+		hits := []Hit{}
+		if found {
+			var err error
+			if hits, err = cachedHits(r, index, query, cache, constants); err != nil {
+				w.Header().Del("ETag")
+				w.Header().Del("Cache-Control")
+				writeError(w, http.StatusServiceUnavailable, "Поиск похожих документов занял слишком много времени")
+				return
+			}
+			hits = query.Applied.arrange(hits, index.Documents)
+		}
+		hitsLimit, _ := strconv.Atoi(constants[ARG_RELATED_HITS])
+		if len(hits) > hitsLimit {
+			hits = hits[:hitsLimit]
+		}
+		bf := bytes.NewBuffer([]byte{})
+		jsonEncoder := json.NewEncoder(bf)
+		jsonEncoder.SetEscapeHTML(false)
+		jsonEncoder.Encode(hits)
+		w.Header().Set("Content-Type", "application/json")
+		writeCompressed(w, encoding, bf.Bytes())
+	}
+}
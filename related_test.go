@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelatedHandler(t *testing.T) {
+	index, constants := testIndex(t, cssDocuments)
+	setIndex(index)
+	defer setIndex(nil)
+	handler := relatedHandler(newResultCache(10), constants)
+	tests := []struct {
+		name   string
+		path   string
+		rules  []Rule
+		status int
+		want   map[string]bool
+	}{
+		{"related by distinctive stems", "/related/css/grid", nil, http.StatusOK, map[string]bool{"/css/layout": true, "/css/grid": false}},
+		{"rules hide related documents", "/related/css/grid", []Rule{{Id: "hide", Match: RULE_MATCH_PATTERN, Query: ".", Hide: []string{"css/layout"}}}, http.StatusOK, map[string]bool{"/css/layout": false, "/css/grid": false}},
+		{"no shared tags", "/related/css/grid?same=tags", nil, http.StatusOK, map[string]bool{}},
+		{"unknown same", "/related/css/grid?same=author", nil, http.StatusBadRequest, nil},
+		{"unknown document", "/related/css/missing", nil, http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		rules, err := newRuleSet(append([]Rule{}, tt.rules...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		setRules(rules)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		hits := []Hit{}
+		if err := json.Unmarshal(w.Body.Bytes(), &hits); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		found := make(map[string]bool)
+		for _, hit := range hits {
+			found[hit.Link] = true
+			if len(hit.Fragments) == 0 {
+				t.Errorf("%s: hit %s has no fragments", tt.name, hit.Link)
+			}
+		}
+		if len(tt.want) == 0 && len(hits) > 0 {
+			t.Errorf("%s: expected no hits, got %d", tt.name, len(hits))
+		}
+		for link, want := range tt.want {
+			if found[link] != want {
+				t.Errorf("%s: %s found = %v, want %v", tt.name, link, found[link], want)
+			}
+		}
+	}
+	setRules(&RuleSet{})
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const RULE_MATCH_EXACT string = "exact"
+const RULE_MATCH_NORMALIZED string = "normalized"
+const RULE_MATCH_PATTERN string = "pattern"
+
+type PinnedResult struct {
+	ObjectId string `json:"objectID" yaml:"objectID"`
+	Position int    `json:"position" yaml:"position"`
+}
+
+// Правило редакционной настройки выдачи для поисковой фразы
+type Rule struct {
+	Id       string         `json:"id" yaml:"id"`
+	Match    string         `json:"match,omitempty" yaml:"match,omitempty"`
+	Query    string         `json:"query" yaml:"query"`
+	Rewrite  string         `json:"rewrite,omitempty" yaml:"rewrite,omitempty"`
+	Pin      []PinnedResult `json:"pin,omitempty" yaml:"pin,omitempty"`
+	Hide     []string       `json:"hide,omitempty" yaml:"hide,omitempty"`
+	Category []string       `json:"category,omitempty" yaml:"category,omitempty"`
+	Tags     []string       `json:"tags,omitempty" yaml:"tags,omitempty"`
+	pattern  *regexp.Regexp
+}
+
+type RuleSet struct {
+	Id    string
+	Rules []Rule
+}
+
+// Результат применения правил к поисковой фразе
+type AppliedRules struct {
+	Query    string
+	Category []string
+	Tags     []string
+	Pin      []PinnedResult
+	Hide     map[string]struct{}
+	Ids      []string
+}
+
+var currentRules = &RuleSet{}
+var currentRulesLock sync.RWMutex
+
+func getRules() *RuleSet {
+	currentRulesLock.RLock()
+	defer currentRulesLock.RUnlock()
+	return currentRules
+}
+
+func setRules(rules *RuleSet) {
+	currentRulesLock.Lock()
+	defer currentRulesLock.Unlock()
+	currentRules = rules
+}
+
+func newRuleSet(rules []Rule) (*RuleSet, error) {
+	ids := make(map[string]struct{})
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Id == "" {
+			return nil, SearchError{time.Now(), fmt.Sprintf("У правила для фразы '%s' не задан идентификатор", rule.Query)}
+		}
+		if _, ok := ids[rule.Id]; ok {
+			return nil, SearchError{time.Now(), fmt.Sprintf("Идентификатор правила '%s' повторяется", rule.Id)}
+		}
+		ids[rule.Id] = struct{}{}
+		if rule.Match == "" {
+			rule.Match = RULE_MATCH_NORMALIZED
+		}
+		switch rule.Match {
+		case RULE_MATCH_EXACT, RULE_MATCH_NORMALIZED:
+		case RULE_MATCH_PATTERN:
+			pattern, err := regexp.Compile("(?i)" + rule.Query)
+			if err != nil {
+				return nil, SearchError{time.Now(), fmt.Sprintf("Некорректный шаблон в правиле '%s': %s", rule.Id, err)}
+			}
+			rule.pattern = pattern
+		default:
+			return nil, SearchError{time.Now(), fmt.Sprintf("Неизвестный тип сопоставления '%s' в правиле '%s'", rule.Match, rule.Id)}
+		}
+	}
+	content, _ := json.Marshal(rules)
+	hash := sha1.Sum(content)
+	return &RuleSet{Id: hex.EncodeToString(hash[:]), Rules: rules}, nil
+}
+
+func loadRules(path string) (*RuleSet, error) {
+	if path == "" {
+		return newRuleSet([]Rule{})
+	}
+	defer timeTrackLoading(time.Now(), fmt.Sprintf("правил из файла '%s'", path))
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newRuleSet([]Rule{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if isYamlFile(path) {
+		err = yaml.Unmarshal(content, &rules)
+	} else {
+		err = json.Unmarshal(content, &rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newRuleSet(rules)
+}
+
+// Правила сохраняются в том же формате, в котором записан файл
+func saveRules(path string, rules []Rule) error {
+	if !isYamlFile(path) {
+		return saveJsonFile(path, rules)
+	}
+	bf := bytes.NewBuffer([]byte{})
+	yamlEncoder := yaml.NewEncoder(bf)
+	yamlEncoder.SetIndent(2)
+	if err := yamlEncoder.Encode(rules); err != nil {
+		return err
+	}
+	return writeFileAtomically(path, bf.Bytes())
+}
+
+func isYamlFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Нормализованная фраза — основы её слов, поэтому правило для «грид» сработает и для «Гриды»
+func normalizeQuery(query string, analyzer Analyzer) string {
+	return strings.Join(analyzer.Analyze(query), " ")
+}
+
+func (rule Rule) matches(query string, analyzer Analyzer) bool {
+	switch rule.Match {
+	case RULE_MATCH_EXACT:
+		return strings.TrimSpace(query) == strings.TrimSpace(rule.Query)
+	case RULE_MATCH_PATTERN:
+		return rule.pattern.MatchString(query)
+	default:
+		normalized := normalizeQuery(rule.Query, analyzer)
+		return normalized != "" && normalized == normalizeQuery(query, analyzer)
+	}
+}
+
+// Применяет подходящие правила по порядку: каждое следующее правило проверяется для уже переписанной фразы
+func (rules *RuleSet) apply(query string, analyzer Analyzer) AppliedRules {
+	applied := AppliedRules{Query: query, Hide: make(map[string]struct{})}
+	for _, rule := range rules.Rules {
+		if !rule.matches(applied.Query, analyzer) {
+			continue
+		}
+		applied.Ids = append(applied.Ids, rule.Id)
+		if rule.Rewrite != "" {
+			if rule.pattern != nil {
+				applied.Query = rule.pattern.ReplaceAllString(applied.Query, rule.Rewrite)
+			} else {
+				applied.Query = rule.Rewrite
+			}
+		}
+		applied.Category = appendUnique(applied.Category, rule.Category)
+		applied.Tags = appendUnique(applied.Tags, rule.Tags)
+		applied.Pin = append(applied.Pin, rule.Pin...)
+		for _, objectId := range rule.Hide {
+			applied.Hide[objectId] = struct{}{}
+		}
+	}
+	return applied
+}
+
+// Скрывает документы и ставит закреплённые документы на заданные позиции (начиная с 1)
+func (applied AppliedRules) arrange(hits []Hit, documents []Document) []Hit {
+	if len(applied.Pin) == 0 && len(applied.Hide) == 0 {
+		return hits
+	}
+	result := []Hit{}
+	pinned := make(map[string]struct{})
+	for _, pin := range applied.Pin {
+		pinned["/"+pin.ObjectId] = struct{}{}
+	}
+	for _, hit := range hits {
+		_, isPinned := pinned[hit.Link]
+		_, isHidden := applied.Hide[strings.TrimPrefix(hit.Link, "/")]
+		if !isPinned && !isHidden {
+			result = append(result, hit)
+		}
+	}
+	for _, pin := range applied.Pin {
+		if _, ok := applied.Hide[pin.ObjectId]; ok {
+			continue
+		}
+		hit, ok := findHit(hits, "/"+pin.ObjectId)
+		if !ok {
+			if hit, ok = documentHit(documents, pin.ObjectId); !ok {
+				continue
+			}
+		}
+		position := pin.Position - 1
+		if position < 0 {
+			position = 0
+		}
+		if position > len(result) {
+			position = len(result)
+		}
+		result = append(result[:position], append([]Hit{hit}, result[position:]...)...)
+	}
+	return result
+}
+
+func findHit(hits []Hit, link string) (Hit, bool) {
+	for _, hit := range hits {
+		if hit.Link == link {
+			return hit, true
+		}
+	}
+	return Hit{}, false
+}
+
+// Закреплённый документ, который не нашёлся по фразе, показывается с началом текста вместо фрагментов
+func documentHit(documents []Document, objectId string) (Hit, bool) {
+	for _, doc := range documents {
+		if doc.ObjectId == objectId {
+			return newDocumentHit(doc), true
+		}
+	}
+	return Hit{}, false
+}
+
+func newDocumentHit(doc Document) Hit {
+	fragments := []string{}
+	if len(doc.Content) > 0 {
+		fragments = append(fragments, trimAndWrap(doc.Content[0]))
+	}
+	return Hit{
+		Title:     doc.Title,
+		Link:      fmt.Sprintf("/%s", doc.ObjectId),
+		Fragments: fragments,
+		Tags:      doc.Tags,
+		Category:  doc.Category,
+	}
+}
+
+type RuleDeleteRequest struct {
+	Id string `json:"id"`
+}
+
+func rulesHandler(constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJson(w, getRules().Rules)
+			return
+		}
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+			return
+		}
+		if constants[ARG_RULES_FILE] == "" {
+			writeError(w, http.StatusConflict, "Путь к файлу правил не задан")
+			return
+		}
+		adminLock.Lock()
+		defer adminLock.Unlock()
+		rules := []Rule{}
+		if r.Method == http.MethodPost {
+			var request Rule
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Id == "" {
+				writeError(w, http.StatusBadRequest, "Ожидается правило вида {\"id\": \"\", \"query\": \"\"}")
+				return
+			}
+			replaced := false
+			for _, rule := range getRules().Rules {
+				if rule.Id == request.Id {
+					rule, replaced = request, true
+				}
+				rules = append(rules, rule)
+			}
+			if !replaced {
+				rules = append(rules, request)
+			}
+		} else {
+			var request RuleDeleteRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Id == "" {
+				writeError(w, http.StatusBadRequest, "Ожидается объект вида {\"id\": \"\"}")
+				return
+			}
+			for _, rule := range getRules().Rules {
+				if rule.Id != request.Id {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		ruleSet, err := newRuleSet(rules)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.(SearchError).What)
+			return
+		}
+		if err := saveRules(constants[ARG_RULES_FILE], ruleSet.Rules); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("Не могу сохранить правила: %s", err))
+			return
+		}
+		setRules(ruleSet)
+		log.Printf("Правила изменены, всего правил: %d", len(ruleSet.Rules))
+		writeJson(w, ruleSet.Rules)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArrange(t *testing.T) {
+	documents := []Document{
+		{ObjectId: "css/grid", Title: "Гриды", Content: []string{"Гриды позволяют строить сетку."}},
+		{ObjectId: "css/flex", Title: "Флексбокс"},
+		{ObjectId: "css/old", Title: "Старая статья"},
+		{ObjectId: "css/guide", Title: "Руководство", Content: []string{"Начало руководства."}},
+	}
+	hits := []Hit{{Link: "/css/grid"}, {Link: "/css/flex"}, {Link: "/css/old"}}
+	tests := []struct {
+		name    string
+		applied AppliedRules
+		want    []string
+	}{
+		{
+			name:    "no rules",
+			applied: AppliedRules{Hide: map[string]struct{}{}},
+			want:    []string{"/css/grid", "/css/flex", "/css/old"},
+		},
+		{
+			name:    "hide",
+			applied: AppliedRules{Hide: map[string]struct{}{"css/old": {}}},
+			want:    []string{"/css/grid", "/css/flex"},
+		},
+		{
+			name:    "pin found hit",
+			applied: AppliedRules{Pin: []PinnedResult{{"css/old", 1}}, Hide: map[string]struct{}{}},
+			want:    []string{"/css/old", "/css/grid", "/css/flex"},
+		},
+		{
+			name:    "pin document not found by phrase",
+			applied: AppliedRules{Pin: []PinnedResult{{"css/guide", 2}}, Hide: map[string]struct{}{}},
+			want:    []string{"/css/grid", "/css/guide", "/css/flex", "/css/old"},
+		},
+		{
+			name:    "pin position out of range",
+			applied: AppliedRules{Pin: []PinnedResult{{"css/grid", 10}, {"css/guide", 0}}, Hide: map[string]struct{}{}},
+			want:    []string{"/css/guide", "/css/flex", "/css/old", "/css/grid"},
+		},
+		{
+			name:    "hidden pin and unknown document",
+			applied: AppliedRules{Pin: []PinnedResult{{"css/old", 1}, {"css/missing", 1}}, Hide: map[string]struct{}{"css/old": {}}},
+			want:    []string{"/css/grid", "/css/flex"},
+		},
+	}
+	for _, tt := range tests {
+		links := []string{}
+		for _, hit := range tt.applied.arrange(hits, documents) {
+			links = append(links, hit.Link)
+		}
+		if !reflect.DeepEqual(links, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, links, tt.want)
+		}
+	}
+
+	applied := AppliedRules{Pin: []PinnedResult{{"css/guide", 1}}, Hide: map[string]struct{}{}}
+	if got := applied.arrange(nil, documents); len(got) != 1 || !reflect.DeepEqual(got[0].Fragments, []string{"Начало руководства."}) {
+		t.Errorf("pinned document should start with its text, got %+v", got)
+	}
+}
+
+func TestLoadRulesFormats(t *testing.T) {
+	dir := t.TempDir()
+	want := []Rule{
+		{Id: "grid-guide", Match: RULE_MATCH_NORMALIZED, Query: "grid", Pin: []PinnedResult{{"css/grid-guide", 1}}, Hide: []string{"css/grid-old"}},
+		{Id: "js", Match: RULE_MATCH_EXACT, Query: "js", Rewrite: "javascript"},
+	}
+	files := map[string]string{
+		"rules.json": `[
+  {"id": "grid-guide", "query": "grid", "pin": [{"objectID": "css/grid-guide", "position": 1}], "hide": ["css/grid-old"]},
+  {"id": "js", "match": "exact", "query": "js", "rewrite": "javascript"}
+]`,
+		"rules.yaml": `- id: grid-guide
+  query: grid
+  pin:
+    - objectID: css/grid-guide
+      position: 1
+  hide: [css/grid-old]
+- id: js
+  match: exact
+  query: js
+  rewrite: javascript
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rules, err := loadRules(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(rules.Rules, want) {
+			t.Errorf("%s: got %+v, want %+v", name, rules.Rules, want)
+		}
+		if err := saveRules(path, rules.Rules); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := loadRules(path)
+		if err != nil {
+			t.Fatalf("%s after save: %s", name, err)
+		}
+		if !reflect.DeepEqual(saved.Rules, want) {
+			t.Errorf("%s after save: got %+v, want %+v", name, saved.Rules, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var cssDocuments = []Document{
+	{
+		ObjectId: "css/grid",
+		Title:    "Гриды",
+		Category: "css",
+		Content:  []string{"Свойство grid-template-columns задаёт колонки grid, а grid-auto-flow — порядок заполнения grid."},
+	},
+	{
+		ObjectId: "css/flex",
+		Title:    "Флексбокс",
+		Category: "css",
+		Content:  []string{"Свойство flex-direction задаёт направление flex, а flex-wrap — перенос элементов flex."},
+	},
+	{
+		ObjectId: "css/layout",
+		Title:    "Раскладки",
+		Category: "css",
+		Content:  []string{"Раскладка grid с grid-template-areas или flex с flex-basis."},
+	},
+}
+
+func testIndex(t *testing.T, docs []Document) (*SearchIndex, map[string]string) {
+	return testIndexWithDictionaries(t, docs, nil, nil)
+}
+
+// Индекс со словарями из файлов «имя → содержимое» и с переопределёнными настройками
+func testIndexWithDictionaries(t *testing.T, docs []Document, dictionaries map[string]string, settings map[string]string) (*SearchIndex, map[string]string) {
+	constants := loadSettings()
+	constants[ARG_DICTS_DIR] = t.TempDir()
+	for name, content := range dictionaries {
+		if err := ioutil.WriteFile(filepath.Join(constants[ARG_DICTS_DIR], name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, value := range settings {
+		constants[key] = value
+	}
+	index, err := buildIndex(docs, map[string]struct{}{}, constants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index, constants
+}
+
+func searchLinks(t *testing.T, index *SearchIndex, constants map[string]string, phrase string) []string {
+	r, err := http.NewRequest("GET", "/?search="+url.QueryEscape(phrase), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := parseSearchQuery(r, index, constants, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := getHits(context.Background(), strings.Split(query.Phrase, " "), index.Documents, index.Stems, index.StemKeys, index.QueryAnalyzer, constants, query.Category, query.Tags, query.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := []string{}
+	for _, hit := range hits {
+		links = append(links, hit.Link)
+	}
+	return links
+}
+
+// Дефис внутри свойства CSS среди вариантов слова не должен превращаться в исключение
+func TestExclusionWithHyphenatedTerms(t *testing.T) {
+	index, constants := testIndex(t, cssDocuments)
+	tests := []struct {
+		phrase string
+		want   []string
+	}{
+		{"grid -flex", []string{"/css/grid"}},
+		{"flex -grid", []string{"/css/flex"}},
+		{"grid+flex", []string{"/css/layout"}},
+		{"-grid", []string{}},
+		{"-grid-flex", []string{}},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := searchLinks(t, index, constants, tt.phrase); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("%q: got %v, want %v", tt.phrase, got, tt.want)
+			}
+		}
+	}
+}
+
+// Переводы из словаря находят документы с исходным термином в обоих режимах расширения
+func TestDictionaryExpansionModes(t *testing.T) {
+	docs := []Document{
+		{ObjectId: "a", Title: "Alpha", Content: []string{"The alpha channel sets transparency."}},
+		{ObjectId: "b", Title: "Beta", Content: []string{"The beta release is almost ready."}},
+	}
+	dictionaries := map[string]string{"terms-test.json": `{"alpha": ["beta"]}`}
+	for _, mode := range []string{DICTS_EXPANSION_INDEX, DICTS_EXPANSION_QUERY} {
+		index, constants := testIndexWithDictionaries(t, docs, dictionaries, map[string]string{ARG_DICTS_EXPANSION_MODE: mode})
+		links := searchLinks(t, index, constants, "beta")
+		sort.Strings(links)
+		if want := []string{"/a", "/b"}; !reflect.DeepEqual(links, want) {
+			t.Errorf("%s mode: got %v, want %v", mode, links, want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const SORT_FIELD_TITLE string = "title"
+const SORT_FIELD_CATEGORY string = "category"
+const SORT_FIELD_OBJECT_ID string = "objectID"
+const SORT_FIELD_UPDATED_AT string = "updatedAt"
+const SORT_FIELD_POPULARITY string = "popularity"
+const SORT_FIELD_BOOST string = "boost"
+
+var sortFields = []string{
+	SORT_FIELD_TITLE,
+	SORT_FIELD_CATEGORY,
+	SORT_FIELD_OBJECT_ID,
+	SORT_FIELD_UPDATED_AT,
+	SORT_FIELD_POPULARITY,
+	SORT_FIELD_BOOST,
+}
+
+// Поле сортировки хитов; при равенстве значений порядок определяет релевантность
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+func (key SortKey) String() string {
+	if key.Descending {
+		return "-" + key.Field
+	}
+	return key.Field
+}
+
+// Разбирает значение параметра `sort` вида `category,-updatedAt`; сортировать можно и по атрибутам документов
+func parseSortKeys(value string, attributes *AttributeIndex) ([]SortKey, error) {
+	keys := []SortKey{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Descending: strings.HasPrefix(part, "-")}
+		if !containsString(sortFields, key.Field) && !attributes.has(key.Field) {
+			return nil, SearchError{time.Now(), fmt.Sprintf("Неизвестное поле сортировки '%s', ожидается одно из значений: %s или атрибут документа", key.Field, strings.Join(sortFields, ", "))}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func sortKeysString(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Порядок букв для сортировки; «ё» сортируется как «е», буквы украинского алфавита стоят после близких русских
+const cyrillicAlphabet string = "абвгґдеєжзиіїйклмнопрстуфхцчшщъыьэюя"
+
+var cyrillicWeights = func() map[rune]int {
+	weights := make(map[rune]int)
+	for i, r := range []rune(cyrillicAlphabet) {
+		weights[r] = i
+	}
+	weights['ё'] = weights['е']
+	return weights
+}()
+
+// Первичные веса символов строки: цифры, затем латиница, затем кириллица, затем прочие буквы.
+// Регистр, диакритика, разметка и знаки препинания не учитываются, пробелы разделяют слова
+func collationKey(s string) []int {
+	s = accentsReplacer.Replace(strings.ToLower(html.UnescapeString(s)))
+	key := []int{}
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			if len(key) > 0 && key[len(key)-1] != 0 {
+				key = append(key, 0)
+			}
+		case r >= '0' && r <= '9':
+			key = append(key, 10+int(r-'0'))
+		case r >= 'a' && r <= 'z':
+			key = append(key, 100+int(r-'a'))
+		case unicode.IsLetter(r):
+			if weight, ok := cyrillicWeights[r]; ok {
+				key = append(key, 200+weight)
+			} else {
+				key = append(key, 1000+int(r))
+			}
+		}
+	}
+	if len(key) > 0 && key[len(key)-1] == 0 {
+		key = key[:len(key)-1]
+	}
+	return key
+}
+
+func compareCollationKeys(a []int, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// Значение поля документа для сортировки; документы без значения всегда оказываются в конце
+type sortValue struct {
+	missing bool
+	text    string
+	key     []int
+	number  float64
+}
+
+func textSortValue(s string) sortValue {
+	key := collationKey(s)
+	return sortValue{missing: len(key) == 0, text: strings.ToLower(s), key: key}
+}
+
+func documentSortValue(doc Document, field string) sortValue {
+	switch field {
+	case SORT_FIELD_TITLE:
+		return textSortValue(doc.Title)
+	case SORT_FIELD_CATEGORY:
+		return textSortValue(doc.Category)
+	case SORT_FIELD_OBJECT_ID:
+		return textSortValue(doc.ObjectId)
+	case SORT_FIELD_UPDATED_AT:
+		updatedAt, err := parseUpdatedAt(doc.UpdatedAt)
+		return sortValue{missing: doc.UpdatedAt == "" || err != nil, number: float64(updatedAt.Unix())}
+	case SORT_FIELD_POPULARITY:
+		return sortValue{number: doc.Popularity}
+	case SORT_FIELD_BOOST:
+		if doc.Boost > 0 {
+			return sortValue{number: doc.Boost}
+		}
+		return sortValue{number: 1}
+	}
+	switch value := doc.Attributes[field].(type) {
+	case string:
+		return textSortValue(value)
+	case float64:
+		return sortValue{number: value}
+	case bool:
+		if value {
+			return sortValue{number: 1}
+		}
+		return sortValue{}
+	}
+	return sortValue{missing: true}
+}
+
+func compareSortValues(a sortValue, b sortValue) int {
+	if a.key != nil || b.key != nil {
+		if c := compareCollationKeys(a.key, b.key); c != 0 {
+			return c
+		}
+		return strings.Compare(a.text, b.text)
+	}
+	if a.number < b.number {
+		return -1
+	}
+	if a.number > b.number {
+		return 1
+	}
+	return 0
+}
+
+// Порядок хитов по полям документов; хиты переданы по убыванию релевантности, поэтому сортировка устойчивая
+func sortOrder(stats []DocStat, documents []Document, keys []SortKey) []int {
+	values := make([][]sortValue, len(stats))
+	order := make([]int, len(stats))
+	for i, stat := range stats {
+		order[i] = i
+		for _, key := range keys {
+			values[i] = append(values[i], documentSortValue(documents[stat.DocIndex], key.Field))
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := values[order[i]], values[order[j]]
+		for k, key := range keys {
+			if a[k].missing != b[k].missing {
+				return b[k].missing
+			}
+			c := compareSortValues(a[k], b[k])
+			if c == 0 {
+				continue
+			}
+			if key.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return order
+}
+
+// Документы, подходящие под фильтры, — для выдачи без поисковой фразы
+func listDocuments(documents []Document, allowed Bitmap) ([]Hit, []DocStat) {
+	hits := []Hit{}
+	stats := []DocStat{}
+	for docIndex, doc := range documents {
+		if allowed.has(docIndex) {
+			hits = append(hits, newDocumentHit(doc))
+			stats = append(stats, DocStat{DocIndex: docIndex, DocTags: doc.Tags, DocCategory: doc.Category})
+		}
+	}
+	return hits, stats
+}
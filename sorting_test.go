@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompareCollationKeys(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"Ёлка", "елка", 0},
+		{"ёж", "ежевика", -1},
+		{"Grid", "grid", 0},
+		{"café", "cafe", 0},
+		{"&lt;a&gt;", "a", 0},
+		{"2D-трансформации", "CSS", -1},
+		{"CSS", "Гриды", -1},
+		{"ёлка", "ель", -1},
+		{"ёлка", "жук", -1},
+		{"гриды", "ґанок", -1},
+		{"ишак", "ірис", -1},
+		{"ірис", "йогурт", -1},
+		{"яблоко", "ωμέγα", -1},
+		{"a b", "ab", -1},
+		{"a  b", "a b", 0},
+		{"", "a", -1},
+	}
+	for _, tt := range tests {
+		got := compareCollationKeys(collationKey(tt.a), collationKey(tt.b))
+		if sign(got) != tt.want {
+			t.Errorf("compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if back := compareCollationKeys(collationKey(tt.b), collationKey(tt.a)); sign(back) != -tt.want {
+			t.Errorf("compare(%q, %q) = %d, want %d", tt.b, tt.a, back, -tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestSortOrder(t *testing.T) {
+	documents := []Document{
+		{ObjectId: "a", Title: "Ёлка", Popularity: 5},
+		{ObjectId: "b", Title: "Анимации", Popularity: 5, Attributes: map[string]interface{}{"level": 2.0}},
+		{ObjectId: "c", Title: "Flexbox", Popularity: 1, Attributes: map[string]interface{}{"level": 1.0}},
+		{ObjectId: "d", Title: "", Popularity: 9},
+		{ObjectId: "e", Title: "елка", Popularity: 0},
+	}
+	stats := []DocStat{}
+	for i := range documents {
+		stats = append(stats, DocStat{DocIndex: i})
+	}
+	tests := []struct {
+		name string
+		keys []SortKey
+		want []string
+	}{
+		{"title", []SortKey{{Field: SORT_FIELD_TITLE}}, []string{"c", "b", "e", "a", "d"}},
+		{"title descending, missing last", []SortKey{{Field: SORT_FIELD_TITLE, Descending: true}}, []string{"a", "e", "b", "c", "d"}},
+		{"popularity keeps relevance on ties", []SortKey{{Field: SORT_FIELD_POPULARITY, Descending: true}}, []string{"d", "a", "b", "c", "e"}},
+		{"attribute, missing last", []SortKey{{Field: "level"}}, []string{"c", "b", "a", "d", "e"}},
+		{"two keys", []SortKey{{Field: SORT_FIELD_POPULARITY}, {Field: SORT_FIELD_TITLE, Descending: true}}, []string{"e", "c", "a", "b", "d"}},
+	}
+	for _, tt := range tests {
+		ids := []string{}
+		for _, i := range sortOrder(stats, documents, tt.keys) {
+			ids = append(ids, documents[stats[i].DocIndex].ObjectId)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+
+	titles := []string{"Яндекс", "ёлка", "Zen", "Ель", "42", "ґанок", "Гриды"}
+	sort.Slice(titles, func(i, j int) bool {
+		return compareCollationKeys(collationKey(titles[i]), collationKey(titles[j])) < 0
+	})
+	if want := []string{"42", "Zen", "Гриды", "ґанок", "ёлка", "Ель", "Яндекс"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("sorted titles: got %v, want %v", titles, want)
+	}
+}
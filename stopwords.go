@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Разница со словарём стоп-слов: каждый список в формате словаря стоп-слов
+type StopWordsDiff struct {
+	Add    map[string]struct{} `json:"add"`
+	Remove map[string]struct{} `json:"remove"`
+}
+
+type StemFrequency struct {
+	Stem              string
+	DocumentFrequency float64
+	TermFrequency     float64
+	Forms             map[string]struct{}
+}
+
+// Считает для каждой основы долю документов, в которых она встречается, и долю среди всех слов корпуса.
+// Основы выделяются анализатором содержимого документов, которому не переданы стоп-слова
+func corpusStemFrequencies(docs []Document, analyzer Analyzer) []StemFrequency {
+	docCounter := make(map[string]int)
+	termCounter := make(map[string]int)
+	forms := make(map[string]map[string]struct{})
+	total := 0
+	for _, doc := range docs {
+		seen := make(map[string]struct{})
+		texts := append([]string{removeSpecialSymbolsFromString(doc.Title)}, doc.Keywords...)
+		texts = append(texts, doc.Content...)
+		for _, text := range texts {
+			for _, token := range tokenize(text) {
+				form := transformLettersFilter([]string{token})[0]
+				for _, stem := range analyzeTerm(analyzer, token) {
+					termCounter[stem]++
+					total++
+					if _, ok := forms[stem]; !ok {
+						forms[stem] = make(map[string]struct{})
+					}
+					forms[stem][form] = struct{}{}
+					if _, ok := seen[stem]; !ok {
+						seen[stem] = struct{}{}
+						docCounter[stem]++
+					}
+				}
+			}
+		}
+	}
+	result := []StemFrequency{}
+	for stem, count := range termCounter {
+		result = append(result, StemFrequency{
+			Stem:              stem,
+			DocumentFrequency: float64(docCounter[stem]) / float64(len(docs)),
+			TermFrequency:     float64(count) / float64(total),
+			Forms:             forms[stem],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DocumentFrequency > result[j].DocumentFrequency
+	})
+	return result
+}
+
+// Команда suggest-stop-words: выводит в stdout разницу с текущим словарём стоп-слов — списки add и remove
+// в формате словаря стоп-слов, а в лог — частоты предложенных и удаляемых слов
+func suggestStopWords(constants map[string]string) {
+	docs, err := loadDocuments(constants[ARG_SEARCH_CONTENT])
+	if err != nil {
+		log.Fatalf("Не могу загрузить документы: %s", err)
+	}
+	stopWords, _ := loadStopWords(constants[ARG_STOP_WORDS])
+	analyzers, _, err := loadAnalyzers(constants[ARG_ANALYZERS_CONFIG], StopWordLists{})
+	if err != nil {
+		log.Fatalf("Не могу загрузить настройки анализаторов из файла '%s': %s", constants[ARG_ANALYZERS_CONFIG], err)
+	}
+	dfThreshold, _ := strconv.ParseFloat(constants[ARG_STOP_WORDS_DF_THRESHOLD], 64)
+	tfThreshold, _ := strconv.ParseFloat(constants[ARG_STOP_WORDS_TF_THRESHOLD], 64)
+	diff := StopWordsDiff{Add: make(map[string]struct{}), Remove: make(map[string]struct{})}
+	// Для каждой формы слова — частоты основы, у которой они наибольшие
+	occurring := make(map[string]StemFrequency)
+	for _, frequency := range corpusStemFrequencies(docs, analyzers[FIELD_CONTENT]) {
+		for form := range frequency.Forms {
+			if current, ok := occurring[form]; !ok || frequency.DocumentFrequency > current.DocumentFrequency {
+				occurring[form] = frequency
+			}
+		}
+	}
+	forms := []string{}
+	for form := range occurring {
+		forms = append(forms, form)
+	}
+	sort.Strings(forms)
+	for _, form := range forms {
+		frequency := occurring[form]
+		if _, ok := stopWords[form]; !ok && frequency.DocumentFrequency >= dfThreshold && frequency.TermFrequency >= tfThreshold {
+			diff.Add[form] = struct{}{}
+			log.Printf("+ %s (df=%.3f, tf=%.5f)", form, frequency.DocumentFrequency, frequency.TermFrequency)
+		}
+	}
+	for _, word := range sortedStopWords(stopWords) {
+		frequency, ok := occurring[word]
+		if !ok {
+			diff.Remove[word] = struct{}{}
+			log.Printf("- %s (не встречается в документах)", word)
+		} else if frequency.DocumentFrequency < dfThreshold || frequency.TermFrequency < tfThreshold {
+			diff.Remove[word] = struct{}{}
+			log.Printf("- %s (df=%.3f, tf=%.5f)", word, frequency.DocumentFrequency, frequency.TermFrequency)
+		}
+	}
+	log.Printf("Предложено стоп-слов: %d, предложено удалить: %d из %d", len(diff.Add), len(diff.Remove), len(stopWords))
+	bf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(bf)
+	jsonEncoder.SetEscapeHTML(false)
+	jsonEncoder.SetIndent("", "  ")
+	jsonEncoder.Encode(diff)
+	fmt.Fprint(os.Stdout, bf.String())
+}
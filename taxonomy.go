@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const TAXONOMY_PATH_SEPARATOR string = ">"
+
+// Описание тега в файле таксономии: синонимы и более общие теги
+type TagDefinition struct {
+	Aliases []string `json:"aliases,omitempty"`
+	Parents []string `json:"parents,omitempty"`
+}
+
+// Файл таксономии: пути категорий вида `css > layout > grid` и описания тегов
+type TaxonomyFile struct {
+	Categories []string                 `json:"categories"`
+	Tags       map[string]TagDefinition `json:"tags"`
+}
+
+type CategoryNode struct {
+	Name     string
+	Path     string
+	Parent   *CategoryNode
+	Children []*CategoryNode
+}
+
+// Иерархия категорий и связи тегов
+type Taxonomy struct {
+	paths      map[string]*CategoryNode
+	names      map[string]*CategoryNode
+	tagAliases map[string]string
+	tagParents map[string][]string
+	tagNames   map[string][]string
+}
+
+func normalizeCategoryPath(path string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(path, TAXONOMY_PATH_SEPARATOR) {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, " "+TAXONOMY_PATH_SEPARATOR+" ")
+}
+
+func newTaxonomy(file TaxonomyFile) *Taxonomy {
+	taxonomy := &Taxonomy{
+		paths:      make(map[string]*CategoryNode),
+		names:      make(map[string]*CategoryNode),
+		tagAliases: make(map[string]string),
+		tagParents: make(map[string][]string),
+		tagNames:   make(map[string][]string),
+	}
+	for _, path := range file.Categories {
+		var parent *CategoryNode
+		for _, segment := range strings.Split(normalizeCategoryPath(path), TAXONOMY_PATH_SEPARATOR) {
+			segment = strings.TrimSpace(segment)
+			nodePath := segment
+			if parent != nil {
+				nodePath = parent.Path + " " + TAXONOMY_PATH_SEPARATOR + " " + segment
+			}
+			node, ok := taxonomy.paths[nodePath]
+			if !ok {
+				node = &CategoryNode{Name: segment, Path: nodePath, Parent: parent}
+				taxonomy.paths[nodePath] = node
+				// Категория без пути ищется по названию; при совпадении названий побеждает объявленная раньше
+				if _, ok := taxonomy.names[segment]; !ok {
+					taxonomy.names[segment] = node
+				}
+				if parent != nil {
+					parent.Children = append(parent.Children, node)
+				}
+			}
+			parent = node
+		}
+	}
+	for tag, definition := range file.Tags {
+		taxonomy.tagNames[tag] = appendUnique([]string{tag}, definition.Aliases)
+		for _, alias := range definition.Aliases {
+			taxonomy.tagAliases[alias] = tag
+		}
+		taxonomy.tagParents[tag] = definition.Parents
+	}
+	return taxonomy
+}
+
+func loadTaxonomy(path string) (*Taxonomy, error) {
+	if path == "" {
+		return newTaxonomy(TaxonomyFile{}), nil
+	}
+	defer timeTrackLoading(time.Now(), fmt.Sprintf("таксономии из файла '%s'", path))
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newTaxonomy(TaxonomyFile{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := TaxonomyFile{}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	return newTaxonomy(file), nil
+}
+
+// Категория документа задаётся полным путём или названием
+func (taxonomy *Taxonomy) category(value string) *CategoryNode {
+	if node, ok := taxonomy.paths[normalizeCategoryPath(value)]; ok {
+		return node
+	}
+	return taxonomy.names[strings.TrimSpace(value)]
+}
+
+// Значения атрибута category для документа: сама категория и все её предки — по названию и по пути
+func (taxonomy *Taxonomy) categoryValues(value string) []string {
+	node := taxonomy.category(value)
+	if node == nil {
+		return []string{value}
+	}
+	values := []string{value}
+	for ; node != nil; node = node.Parent {
+		values = appendUnique(values, []string{node.Name, node.Path})
+	}
+	return values
+}
+
+func (taxonomy *Taxonomy) canonicalTag(tag string) string {
+	if canonical, ok := taxonomy.tagAliases[tag]; ok {
+		return canonical
+	}
+	return tag
+}
+
+// Тег и все более общие теги без синонимов
+func (taxonomy *Taxonomy) tagAncestors(tag string) []string {
+	result := []string{}
+	seen := make(map[string]struct{})
+	queue := []string{taxonomy.canonicalTag(tag)}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[current]; ok {
+			continue
+		}
+		seen[current] = struct{}{}
+		result = append(result, current)
+		for _, parent := range taxonomy.tagParents[current] {
+			queue = append(queue, taxonomy.canonicalTag(parent))
+		}
+	}
+	return result
+}
+
+// Значения атрибута tags для тега документа: тег, более общие теги и синонимы каждого из них
+func (taxonomy *Taxonomy) tagValues(tag string) []string {
+	values := []string{tag}
+	for _, ancestor := range taxonomy.tagAncestors(tag) {
+		values = appendUnique(values, append([]string{ancestor}, taxonomy.tagNames[ancestor]...))
+	}
+	return values
+}
+
+type CategoryFacet struct {
+	Name     string           `json:"name"`
+	Path     string           `json:"path"`
+	Count    int              `json:"count"`
+	Children []*CategoryFacet `json:"children,omitempty"`
+}
+
+type TagFacet struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Total      int              `json:"total"`
+	Categories []*CategoryFacet `json:"categories"`
+	Tags       []TagFacet       `json:"tags"`
+}
+
+// Количество хитов по категориям и тегам: хит учитывается и во всех родительских категориях и тегах
+func (taxonomy *Taxonomy) facets(hits []Hit) Facets {
+	facets := Facets{Total: len(hits), Categories: []*CategoryFacet{}, Tags: []TagFacet{}}
+	categories := make(map[string]*CategoryFacet)
+	var facetOf func(node *CategoryNode) *CategoryFacet
+	facetOf = func(node *CategoryNode) *CategoryFacet {
+		if facet, ok := categories[node.Path]; ok {
+			return facet
+		}
+		facet := &CategoryFacet{Name: node.Name, Path: node.Path}
+		categories[node.Path] = facet
+		if node.Parent != nil {
+			parent := facetOf(node.Parent)
+			parent.Children = append(parent.Children, facet)
+		} else {
+			facets.Categories = append(facets.Categories, facet)
+		}
+		return facet
+	}
+	tags := make(map[string]int)
+	for _, hit := range hits {
+		if hit.Category != "" {
+			node := taxonomy.category(hit.Category)
+			if node == nil {
+				node = &CategoryNode{Name: hit.Category, Path: hit.Category}
+			}
+			for ; node != nil; node = node.Parent {
+				facetOf(node).Count++
+			}
+		}
+		counted := make(map[string]struct{})
+		for _, tag := range hit.Tags {
+			for _, ancestor := range taxonomy.tagAncestors(tag) {
+				if _, ok := counted[ancestor]; !ok {
+					counted[ancestor] = struct{}{}
+					tags[ancestor]++
+				}
+			}
+		}
+	}
+	sortCategoryFacets(facets.Categories)
+	for tag, count := range tags {
+		facets.Tags = append(facets.Tags, TagFacet{Name: tag, Count: count})
+	}
+	sort.Slice(facets.Tags, func(i, j int) bool {
+		if facets.Tags[i].Count != facets.Tags[j].Count {
+			return facets.Tags[i].Count > facets.Tags[j].Count
+		}
+		return compareCollationKeys(collationKey(facets.Tags[i].Name), collationKey(facets.Tags[j].Name)) < 0
+	})
+	return facets
+}
+
+func sortCategoryFacets(list []*CategoryFacet) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return compareCollationKeys(collationKey(list[i].Name), collationKey(list[j].Name)) < 0
+	})
+	for _, facet := range list {
+		sortCategoryFacets(facet.Children)
+	}
+}
+
+func facetsHandler(cache *ResultCache, constants map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index := getIndex()
+		query, err := parseSearchQuery(r, index, constants, true)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.(SearchError).What)
+			return
+		}
+		start := time.Now()
+		hits, err := cachedHits(r, index, query, cache, constants)
+		timeTrackSearch(start, query.Phrase, requestClientIp(r), query.Category, query.Tags, constants)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "Поиск занял слишком много времени, уточните запрос")
+			return
+		}
+		writeJson(w, index.Taxonomy.facets(query.Applied.arrange(hits, index.Documents)))
+	}
+}
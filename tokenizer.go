@@ -0,0 +1,75 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Термины из документации по веб-разработке: теги HTML, псевдоклассы и псевдоэлементы, @-правила CSS,
+// свойства CSS через дефис и цепочки идентификаторов JavaScript через точку
+var codeTermRegexp = regexp.MustCompile(`</?([A-Za-z][A-Za-z0-9-]*)(?:\s[^<>]*)?>|::?[A-Za-z][A-Za-z0-9-]*|@[A-Za-z][A-Za-z0-9-]*|[\p{L}\p{N}_]+(?:[.-][\p{L}\p{N}_]+)*`)
+
+// Сохраняет термины вроде `grid-template-columns`, `<a>`, `::before`, `Array.prototype.map` целиком
+// и дополнительно выделяет их части, в том числе из camelCase и kebab-case
+func codeTokenize(text string) []string {
+	text = html.UnescapeString(text)
+	tokens := []string{}
+	for _, match := range codeTermRegexp.FindAllStringSubmatch(text, -1) {
+		term := match[0]
+		if match[1] != "" {
+			term = "<" + match[1] + ">"
+		}
+		tokens = append(tokens, term)
+		seen := map[string]struct{}{term: {}}
+		for _, part := range codeTermParts(term) {
+			if _, ok := seen[part]; !ok && utf8.RuneCountInString(part) > 1 {
+				seen[part] = struct{}{}
+				tokens = append(tokens, part)
+			}
+		}
+	}
+	return tokens
+}
+
+func codeTermParts(term string) []string {
+	parts := []string{}
+	for _, word := range tokenize(strings.ReplaceAll(term, "_", " ")) {
+		camelParts := splitCamelCase(word)
+		if len(camelParts) > 1 || word != term {
+			parts = append(parts, word)
+		}
+		if len(camelParts) > 1 {
+			parts = append(parts, camelParts...)
+		}
+	}
+	return parts
+}
+
+// querySelectorAll → query, Selector, All; XMLHttpRequest → XML, Http, Request
+func splitCamelCase(word string) []string {
+	runes := []rune(word)
+	parts := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// Термины из кода не приводятся к основе слова, чтобы искать их точно
+func isCodeTerm(token string) bool {
+	for _, r := range token {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+)
+
+// Транслитерация по ГОСТ Р 52535.1 (ISO 9 без диакритических знаков)
+var cyrillicToLatinStrict = strings.NewReplacer(
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "е", "e", "ё", "e", "ж", "zh", "з", "z", "и", "i",
+	"й", "i", "к", "k", "л", "l", "м", "m", "н", "n", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t",
+	"у", "u", "ф", "f", "х", "kh", "ц", "ts", "ч", "ch", "ш", "sh", "щ", "shch", "ъ", "ie", "ы", "y", "ь", "",
+	"э", "e", "ю", "iu", "я", "ia", "і", "i", "ї", "i", "є", "ie", "ґ", "g",
+)
+
+// Транслитерация «на слух», которой пишут английские заимствования: «джаваскрипт» → javaskript
+var cyrillicToLatinPhonetic = strings.NewReplacer(
+	"дж", "j", "кс", "x", "ью", "u",
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "е", "e", "ё", "yo", "ж", "zh", "з", "z", "и", "i",
+	"й", "y", "к", "k", "л", "l", "м", "m", "н", "n", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t",
+	"у", "u", "ф", "f", "х", "h", "ц", "ts", "ч", "ch", "ш", "sh", "щ", "sch", "ъ", "", "ы", "y", "ь", "",
+	"э", "e", "ю", "yu", "я", "ya", "і", "i", "ї", "yi", "є", "ye", "ґ", "g",
+)
+
+// Обратная транслитерация: flexbox → флексбокс, react → реакт
+var latinToCyrillicPhonetic = strings.NewReplacer(
+	"shch", "щ", "sch", "ш", "sh", "ш", "ch", "ч", "zh", "ж", "kh", "х", "ts", "ц", "ph", "ф", "th", "т",
+	"ya", "я", "yu", "ю", "yo", "е", "ck", "к", "oo", "у", "ee", "и",
+	"ce", "се", "ci", "си", "cy", "си",
+	"a", "а", "b", "б", "c", "к", "d", "д", "e", "е", "f", "ф", "g", "г", "h", "х", "i", "и", "j", "дж",
+	"k", "к", "l", "л", "m", "м", "n", "н", "o", "о", "p", "п", "q", "к", "r", "р", "s", "с", "t", "т",
+	"u", "у", "v", "в", "w", "в", "x", "кс", "y", "и", "z", "з",
+)
+
+// Названия, которые не удаётся получить транслитерацией по правилам
+var defaultTransliterationExceptions = Dictionary{
+	"джаваскрипт": {"javascript"},
+	"жаваскрипт":  {"javascript"},
+	"яваскрипт":   {"javascript"},
+	"тайпскрипт":  {"typescript"},
+	"жс":          {"js"},
+	"реакт":       {"react"},
+	"вью":         {"vue"},
+	"ангуляр":     {"angular"},
+	"нода":        {"node"},
+	"хтмл":        {"html"},
+	"цсс":         {"css"},
+	"джейсон":     {"json"},
+	"аякс":        {"ajax"},
+	"гит":         {"git"},
+}
+
+// Таблица исключений хранится по основам слов в обе стороны, так как в запросе уже выделены основы
+func newTransliterationExceptions(analyzer Analyzer, dictionaries ...Dictionary) map[string][]string {
+	exceptions := make(map[string][]string)
+	for _, dic := range dictionaries {
+		for term, variations := range dic {
+			termStems := analyzeTerm(analyzer, term)
+			for _, variation := range variations {
+				for _, variationStem := range analyzeTerm(analyzer, variation) {
+					for _, termStem := range termStems {
+						exceptions[termStem] = appendUnique(exceptions[termStem], []string{variationStem})
+						exceptions[variationStem] = appendUnique(exceptions[variationStem], []string{termStem})
+					}
+				}
+			}
+		}
+	}
+	return exceptions
+}
+
+// Варианты написания слова другой письменностью
+func transliterate(token string, exceptions map[string][]string) []string {
+	candidates := append([]string{}, exceptions[token]...)
+	cyrillic, latin := countScripts(token)
+	if cyrillic > 0 && latin == 0 {
+		candidates = appendUnique(candidates, []string{
+			cyrillicToLatinStrict.Replace(token),
+			cyrillicToLatinPhonetic.Replace(token),
+		})
+	} else if latin > 0 && cyrillic == 0 {
+		candidates = appendUnique(candidates, []string{latinToCyrillicPhonetic.Replace(token)})
+	}
+	return candidates
+}